@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// directory where agent sockets are mounted inside the container
+const containerAgentDir = "/tmp/devc-agent"
+
+// name of the proxy socket of the ssh agent
+const sshAgentSocket = "ssh-agent.sock"
+
+// name of the proxy socket of the gpg agent
+const gpgAgentSocket = "gpg-agent.sock"
+
+// shell script wiring the forwarded gpg agent and the exported public keyring
+// inside the container
+const gpgSetupScript = `command -v gpg >/dev/null 2>&1 || { echo "gpg is not installed" >&2; exit 0; }
+socket=$(gpgconf --list-dirs agent-socket 2>/dev/null || echo "$HOME/.gnupg/S.gpg-agent")
+mkdir -p "$(dirname "$socket")"
+chmod 700 "$(dirname "$socket")"
+ln -sf "$0/gpg-agent.sock" "$socket"
+gpg --batch --quiet --import "$0/pubring.asc"
+gpg --batch --quiet --import-ownertrust "$0/ownertrust.txt"
+if command -v git >/dev/null 2>&1; then git config --global gpg.program gpg; fi`
+
+// AgentDir return the host directory holding the agent proxy sockets
+func (d *DevContainer) AgentDir() string {
+	return filepath.Join(d.StateDir(), "agent")
+}
+
+// ForwardsAgents return true if an agent is forwarded into the container
+func (d *DevContainer) ForwardsAgents() bool {
+	return d.Config.GetBool("customizations.devc.forwardSshAgent") ||
+		d.Config.GetBool("customizations.devc.forwardGpgAgent")
+}
+
+// SetAgentForwarding mount the agent proxy sockets directory into the
+// container and point the agents environment variables to it
+func (d *DevContainer) SetAgentForwarding() {
+	// the git credential socket is in the same directory
+	if !d.ForwardsAgents() && !d.Config.GetBool("customizations.devc.copyGitConfig") {
+		return
+	}
+
+	// the directory is mounted rather than the sockets, so that they can be
+	// recreated while the container is running
+	mkdir := func() error { return os.MkdirAll(d.AgentDir(), 0700) }
+	if err := hostChange(shellJoin([]string{"mkdir", "-m", "700", "-p", d.AgentDir()}), mkdir); err != nil {
+		log.Fatal().Err(err).Msg("cannot create agent directory")
+	}
+	d.Config.Set("mounts", append(
+		d.Config.GetStringSlice("mounts"),
+		"type=bind,source="+d.AgentDir()+",target="+containerAgentDir,
+	))
+
+	if d.Config.GetBool("customizations.devc.forwardSshAgent") {
+		remoteEnv := d.Config.GetStringMapString("remoteEnv")
+		remoteEnv["SSH_AUTH_SOCK"] = containerAgentDir + "/" + sshAgentSocket
+		d.Config.Set("remoteEnv", remoteEnv)
+	}
+}
+
+// SetupGpg export the public keyring into the container and wire the
+// forwarded gpg agent
+func (d *DevContainer) SetupGpg() {
+	if !d.Config.GetBool("customizations.devc.forwardGpgAgent") {
+		return
+	}
+
+	// the agent directory is mounted into the container
+	exports := map[string][]string{
+		"pubring.asc":    {"gpg", "--export", "--armor"},
+		"ownertrust.txt": {"gpg", "--export-ownertrust"},
+	}
+	for file, cmd := range exports {
+		path := filepath.Join(d.AgentDir(), file)
+		export := func() error {
+			out, err := execCmd(cmd, true)
+			if err != nil {
+				return err
+			}
+
+			return os.WriteFile(path, []byte(out+"\n"), 0644)
+		}
+		if err := hostChange(shellJoin(cmd)+" > "+shellQuote(path), export); err != nil {
+			log.Error().Err(err).Msg("cannot export gpg keyring")
+			return
+		}
+	}
+
+	if out, err := d.Engine.Exec([]string{"sh", "-c", gpgSetupScript, containerAgentDir}, true); err != nil {
+		log.Error().Err(err).Str("output", out).Msg("cannot setup gpg")
+	}
+}
+
+// ProxySocket listen on the given unix socket and proxy its connections to
+// the target socket
+func (f *Forwarder) ProxySocket(path string, target string) error {
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	// only the host user, and the remote user sharing its uid, can use the
+	// agent keys
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	log.Info().Str("socket", path).Str("target", target).Msg("socket forwarded")
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Error().Err(err).Str("socket", path).Msg("cannot accept connection")
+				return
+			}
+			go func() {
+				remote, err := net.Dial("unix", target)
+				if err != nil {
+					log.Error().Err(err).Str("socket", target).Msg("cannot connect to socket")
+					conn.Close()
+					return
+				}
+				pipe(conn, remote)
+			}()
+		}
+	}()
+
+	return nil
+}
+
+// ForwardAgents start the proxies of the forwarded agents
+func (f *Forwarder) ForwardAgents() {
+	if f.devc.Config.GetBool("customizations.devc.forwardSshAgent") {
+		f.state.SSHAuthSock = os.Getenv("SSH_AUTH_SOCK")
+		if f.state.SSHAuthSock == "" {
+			log.Warn().Msg("SSH_AUTH_SOCK is not set, ssh agent is not forwarded")
+		} else if err := f.ProxySocket(filepath.Join(f.devc.AgentDir(), sshAgentSocket), f.state.SSHAuthSock); err != nil {
+			log.Error().Err(err).Msg("cannot forward ssh agent")
+		}
+	}
+	if f.devc.Config.GetBool("customizations.devc.forwardGpgAgent") {
+		// the extra socket restricts the operations available to remote users
+		if target, err := execCmd([]string{"gpgconf", "--list-dirs", "agent-extra-socket"}, true); err != nil {
+			log.Error().Err(err).Msg("cannot find gpg agent extra socket")
+		} else if err := f.ProxySocket(filepath.Join(f.devc.AgentDir(), gpgAgentSocket), target); err != nil {
+			log.Error().Err(err).Msg("cannot forward gpg agent")
+		}
+	}
+	f.save()
+}
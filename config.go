@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// path of the devcontainer configuration edited by the edit commands
+func devcontainerPath() string {
+	return filepath.Join(rootConfigDir, "devcontainer.json")
+}
+
+// read the configuration file, an empty user configuration if it is missing
+func readConfig(path string) ([]byte, error) {
+	src, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && path == UserConfigPath() {
+		return []byte("{}\n"), nil
+	}
+
+	return src, err
+}
+
+// write the edited configuration file, warning about schema violations
+func writeConfig(path string, src []byte) {
+	if path != UserConfigPath() {
+		errs, warnings := ValidateFile(path, src)
+		for _, e := range append(errs, warnings...) {
+			log.Warn().Msg(e)
+		}
+	}
+	if err := writeFile(path, src); err != nil {
+		log.Fatal().Err(err).Msg("cannot write settings")
+	}
+}
+
+// parse a command line value as JSON, and fallback to a string
+func parseValue(s string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(s), &value); err != nil {
+		return s
+	}
+
+	return value
+}
+
+// flatten nested settings into dotted keys
+func flattenSettings(prefix string, settings map[string]interface{}, flat map[string]interface{}) {
+	for key, value := range settings {
+		if sub, ok := value.(map[string]interface{}); ok && len(sub) > 0 {
+			flattenSettings(prefix+key+".", sub, flat)
+		} else {
+			flat[prefix+key] = value
+		}
+	}
+}
+
+// print the setting at the dotted key of the configuration file
+func getSetting(path string, key string) {
+	src, err := readConfig(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot read settings")
+	}
+	root, err := ParseJSONC(src)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot parse settings")
+	}
+
+	node := root
+	for _, part := range strings.Split(key, ".") {
+		member := node.Member(part)
+		if node.Kind != "object" || member == nil {
+			log.Fatal().Str("key", key).Msg("setting is not set")
+		}
+		node = member.Value
+	}
+	if s, ok := node.Value.(string); ok {
+		fmt.Println(s)
+		return
+	}
+	value, _ := json.Marshal(node.Interface())
+	fmt.Println(string(value))
+}
+
+// print the settings of the configuration file with their dotted keys
+func listSettings(path string) {
+	src, err := readConfig(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot read settings")
+	}
+	root, err := ParseJSONC(src)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot parse settings")
+	}
+	settings, ok := root.Interface().(map[string]interface{})
+	if !ok {
+		log.Fatal().Msg("settings must be an object")
+	}
+
+	flat := map[string]interface{}{}
+	flattenSettings("", settings, flat)
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, _ := json.Marshal(flat[key])
+		fmt.Printf("%s=%s\n", key, value)
+	}
+}
+
+// change the setting at the dotted key of the configuration file
+func setSetting(path string, key string, value string) {
+	src, err := readConfig(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot read settings")
+	}
+	out, err := SetJSONC(src, strings.Split(key, "."), parseValue(value))
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot change setting")
+	}
+	writeConfig(path, out)
+}
+
+// COMMANDS
+
+func (d *DevContainer) ConfigGet(_ *cobra.Command, args []string) {
+	getSetting(UserConfigPath(), args[0])
+}
+
+func (d *DevContainer) ConfigList(_ *cobra.Command, _ []string) {
+	listSettings(UserConfigPath())
+}
+
+func (d *DevContainer) ConfigSet(_ *cobra.Command, args []string) {
+	setSetting(UserConfigPath(), args[0], args[1])
+}
+
+func (d *DevContainer) EditGet(_ *cobra.Command, args []string) {
+	getSetting(devcontainerPath(), args[0])
+}
+
+func (d *DevContainer) EditList(_ *cobra.Command, _ []string) {
+	listSettings(devcontainerPath())
+}
+
+func (d *DevContainer) EditSet(_ *cobra.Command, args []string) {
+	setSetting(devcontainerPath(), args[0], args[1])
+}
+
+func (d *DevContainer) FeaturesAdd(_ *cobra.Command, args []string) {
+	options := map[string]interface{}{}
+	for key, value := range splitOptions(featuresAddOptions) {
+		// feature options are strings or booleans, keep versions as strings
+		if value == "true" || value == "false" {
+			options[key] = value == "true"
+		} else {
+			options[key] = value
+		}
+	}
+
+	path := devcontainerPath()
+	src, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot read devcontainer settings")
+	}
+	out, err := SetJSONC(src, []string{"features", args[0]}, options)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot add feature")
+	}
+	writeConfig(path, out)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// resolve a host path against the workspace, or a ":"-prefixed container path
+// against the workspace folder
+func (d *DevContainer) copyPath(p string) string {
+	// a trailing "/" or "/." changes what is copied
+	suffix := ""
+	if strings.HasSuffix(p, "/.") {
+		suffix = "/."
+	} else if strings.HasSuffix(p, "/") {
+		suffix = "/"
+	}
+	if strings.HasPrefix(p, ":") {
+		p = strings.TrimPrefix(p, ":")
+		if !path.IsAbs(p) {
+			p = strings.TrimSuffix(path.Join(d.Config.GetString("workspaceFolder"), p), "/") + suffix
+		}
+		return ":" + p
+	}
+	if !filepath.IsAbs(p) {
+		p = strings.TrimSuffix(filepath.Join(d.WorkingDirectoryPath, p), "/") + suffix
+	}
+
+	return p
+}
+
+// COMMANDS
+
+func (d *DevContainer) Copy(_ *cobra.Command, args []string) {
+	src, dst := d.copyPath(args[0]), d.copyPath(args[1])
+	toContainer := strings.HasPrefix(dst, ":")
+	if toContainer == strings.HasPrefix(src, ":") {
+		log.Fatal().Msg("exactly one of the paths must be a container path, prefixed with \":\"")
+	}
+
+	// the copied path, which goes into the destination if it is a directory,
+	// guessed from a trailing slash when nothing is run
+	target := strings.TrimPrefix(dst, ":")
+	if toContainer && !strings.HasSuffix(args[0], "/.") {
+		isDir := strings.HasSuffix(target, "/")
+		if !rootDryRun {
+			_, err := d.Engine.Exec([]string{"test", "-d", target}, true)
+			isDir = err == nil
+		}
+		if isDir {
+			target = path.Join(target, filepath.Base(src))
+		}
+	}
+
+	if _, err := d.Engine.Copy(src, dst); err != nil {
+		log.Fatal().Err(err).Msg("cannot copy")
+	}
+
+	// files copied into the container belong to root otherwise
+	user := d.Config.GetString("remoteUser")
+	if user == "" {
+		user = d.Config.GetString("containerUser")
+	}
+	if toContainer && user != "" && user != "root" {
+		if _, err := d.Engine.Chown(target, user); err != nil {
+			log.Fatal().Err(err).Msg("cannot change owner")
+		}
+	}
+}
@@ -9,8 +9,11 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"text/tabwriter"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -31,60 +34,180 @@ type Engine interface {
 	IsRunning() (bool, error)
 	Build() (string, error)
 	Create() (string, error)
-	Remove() (string, error)
+	Remove(volumes bool) (string, error)
 	Start() (string, error)
 	Stop() (string, error)
 	List() (string, error)
 	Run(command []string) (string, error)
-	Exec(command []string) (string, error)
+	Exec(command []string, capture bool) (string, error)
+	ExecArgs(command []string, tty bool) []string
+	Inspect(format string) (string, error)
 	ResolveEnv(env string) string
+	Volumes(filters ...string) ([]string, error)
+	Logs(follow bool) (string, error)
+	Copy(src string, dst string) (string, error)
+	Chown(path string, user string) (string, error)
+	GetImage() (string, error)
 }
 
 // devcontainer meta-structure
 type DevContainer struct {
+	_ExecCmd             func([]string, bool, ...io.Writer) (string, error)
 	ConfigDir            string
 	Config               *viper.Viper
+	ConfigHash           string
+	BuildHash            string
+	ID                   string
+	Instance             string
+	UserConfig           *viper.Viper
 	Engine               Engine
+	Timings              Timings
 	WorkingDirectoryPath string
 	WorkingDirectoryName string
 }
 
 var version string
 
+// container engine command, docker or a compatible one like podman
+var dockerBin = "docker"
+
 // global devcontainer var
 var devc DevContainer
 
+// annotation of the commands working on the devcontainer
+const devcontainerAnnotation = "devcontainer"
+
 // DEVC COMMANDS
 
 // cli args
+var buildCacheToFlag string
+var buildPlatformFlag string
+var buildSecretsFlag []string
+var buildSSHFlag []string
 var rootConfigDir string
+var rootDryRun bool
+var rootInstance string
+var rootLogFile string
+var rootLogFormat string
 var rootVerbose int
+var featuresAddOptions []string
+var initList bool
+var initOptions []string
+var initTemplate string
+var logsContainer bool
+var logsFollow bool
+var logsStep string
 var manOutDir string
+var prebuildPush bool
+var pruneDays int
+var pruneForce bool
 var shellBin string
+var startAutoRebuild bool
+var startDotfilesInstallCommand string
+var startDotfilesRepository string
+var startDotfilesTargetPath string
+var statusOutput string
 var stopRemove bool
+var stopVolumes bool
+var timingsSummary bool
+var timingsTraceFile string
 
 func init() {
 	// devc command
 	rootCmd.PersistentFlags().StringVarP(&rootConfigDir, "config-dir", "c", ".devcontainer", "custom devcontainer directory")
+	rootCmd.PersistentFlags().BoolVar(&rootDryRun, "dry-run", false, "print commands instead of running them")
+	rootCmd.PersistentFlags().StringVar(&rootInstance, "instance", "", "name of an additional devcontainer of the workspace")
+	rootCmd.PersistentFlags().StringVar(&rootLogFile, "log-file", "", "write logs to the given file instead of stderr")
+	rootCmd.PersistentFlags().StringVar(&rootLogFormat, "log-format", "console", "log format: console or json")
 	rootCmd.PersistentFlags().CountVarP(&rootVerbose, "verbose", "v", "enable verbose output")
 	// build sub-command
 	rootCmd.AddCommand(buildCmd)
+	// config sub-command
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configSetCmd)
+	rootCmd.AddCommand(configCmd)
+	// cp sub-command
+	rootCmd.AddCommand(cpCmd)
+	// edit sub-command
+	editCmd.AddCommand(editGetCmd)
+	editCmd.AddCommand(editListCmd)
+	editCmd.AddCommand(editSetCmd)
+	rootCmd.AddCommand(editCmd)
+	// features sub-command
+	featuresAddCmd.PersistentFlags().StringArrayVarP(&featuresAddOptions, "option", "o", nil, "feature option as key=value")
+	featuresCmd.AddCommand(featuresAddCmd)
+	rootCmd.AddCommand(featuresCmd)
+	// forward sub-command
+	rootCmd.AddCommand(forwardCmd)
 	// init sub-command
+	initCmd.PersistentFlags().StringVarP(&initTemplate, "template", "t", "", "template id, directory or OCI reference (default: detected from workspace)")
+	initCmd.PersistentFlags().StringArrayVarP(&initOptions, "option", "o", nil, "template option as key=value")
+	initCmd.PersistentFlags().BoolVarP(&initList, "list", "l", false, "list built-in templates")
 	rootCmd.AddCommand(initCmd)
 	// list sub-command
 	rootCmd.AddCommand(listCmd)
+	// logs sub-command
+	logsCmd.PersistentFlags().BoolVarP(&logsContainer, "container", "C", false, "show container logs instead of lifecycle commands ones")
+	logsCmd.PersistentFlags().BoolVarP(&logsFollow, "follow", "f", false, "follow logs output")
+	logsCmd.PersistentFlags().StringVarP(&logsStep, "step", "s", "", "only show the logs of the given lifecycle step, e.g. postCreate")
+	rootCmd.AddCommand(logsCmd)
 	// man sub-command
 	manCmd.PersistentFlags().StringVarP(&manOutDir, "output", "o", "man", "output directory")
 	rootCmd.AddCommand(manCmd)
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
+	// ports sub-command
+	portsCmd.AddCommand(portsAddCmd)
+	rootCmd.AddCommand(portsCmd)
+	// prebuild sub-command
+	prebuildCmd.PersistentFlags().BoolVar(&prebuildPush, "push", false, "push the image once built")
+	rootCmd.AddCommand(prebuildCmd)
+	// prune sub-command
+	pruneCmd.PersistentFlags().IntVarP(&pruneDays, "days", "d", 30, "remove resources unused for this number of days, 0 to only remove the ones of deleted folders")
+	pruneCmd.PersistentFlags().BoolVarP(&pruneForce, "force", "f", false, "remove without confirmation")
+	rootCmd.AddCommand(pruneCmd)
 	// shell sub-command
 	shellCmd.PersistentFlags().StringVarP(&shellBin, "shell", "s", "sh", "override shell")
 	rootCmd.AddCommand(shellCmd)
 	// start sub-command
 	rootCmd.AddCommand(startCmd)
+	// shell and start sub-commands both start the devcontainer
+	for _, cmd := range []*cobra.Command{buildCmd, prebuildCmd, shellCmd, startCmd} {
+		cmd.PersistentFlags().BoolVar(&timingsSummary, "timings", false, "print a summary of the phases durations")
+		cmd.PersistentFlags().StringVar(&timingsTraceFile, "trace-file", "", "write the phases durations as a Chrome trace-event JSON file")
+		cmd.PersistentFlags().StringVar(&buildCacheToFlag, "cache-to", "", "export the build cache, to a local directory if a path is given")
+		cmd.PersistentFlags().StringVar(&buildPlatformFlag, "platform", "", "build the image for the given platform, e.g. linux/arm64")
+		cmd.PersistentFlags().StringArrayVar(&buildSecretsFlag, "secret", nil, "build secret as id=name,src=path or id=name,env=VAR")
+		cmd.PersistentFlags().StringArrayVar(&buildSSHFlag, "ssh", nil, "ssh agent socket or keys to expose to the build, e.g. default")
+	}
+	for _, cmd := range []*cobra.Command{shellCmd, startCmd} {
+		cmd.PersistentFlags().BoolVar(&startAutoRebuild, "auto-rebuild", false, "rebuild devcontainer when its configuration changed")
+		cmd.PersistentFlags().StringVar(&startDotfilesRepository, "dotfiles-repository", "", "dotfiles repository to install in devcontainer")
+		cmd.PersistentFlags().StringVar(&startDotfilesInstallCommand, "dotfiles-install-command", "", "command installing the dotfiles")
+		cmd.PersistentFlags().StringVar(&startDotfilesTargetPath, "dotfiles-target-path", "~/dotfiles", "path where the dotfiles are cloned")
+	}
+	// validate sub-command
+	rootCmd.AddCommand(validateCmd)
+	// status sub-command
+	statusCmd.PersistentFlags().StringVarP(&statusOutput, "output", "o", "text", "output format: text or json")
+	rootCmd.AddCommand(statusCmd)
 	// stop sub-command
 	stopCmd.PersistentFlags().BoolVarP(&stopRemove, "remove", "r", false, "remove containers and networks")
+	stopCmd.PersistentFlags().BoolVar(&stopVolumes, "volumes", false, "remove named volumes too, with --remove")
 	rootCmd.AddCommand(stopCmd)
+	// volumes sub-command
+	volumesCmd.AddCommand(volumesListCmd)
+	volumesCmd.AddCommand(volumesPruneCmd)
+	volumesCmd.AddCommand(volumesRemoveCmd)
+	rootCmd.AddCommand(volumesCmd)
+	// commands working on the devcontainer, which load its configuration and
+	// engine before running
+	for _, cmd := range []*cobra.Command{
+		buildCmd, cpCmd, forwardCmd, listCmd, logsCmd, portsCmd, prebuildCmd, shellCmd,
+		startCmd, statusCmd, stopCmd, volumesListCmd, volumesPruneCmd, volumesRemoveCmd,
+	} {
+		cmd.Annotations = map[string]string{devcontainerAnnotation: "true"}
+	}
 }
 
 var rootCmd = &cobra.Command{
@@ -101,6 +224,85 @@ var buildCmd = &cobra.Command{
 	Run:   devc.Build,
 }
 
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage user configuration",
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a user configuration setting",
+	Args:  cobra.ExactArgs(1),
+	Run:   devc.ConfigGet,
+}
+
+var configListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List user configuration settings",
+	Run:     devc.ConfigList,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a user configuration setting",
+	Args:  cobra.ExactArgs(2),
+	Run:   devc.ConfigSet,
+}
+
+var cpCmd = &cobra.Command{
+	Use:   "cp <src> <dst>",
+	Short: "Copy files between host and devcontainer",
+	Long:  "Copy files between host and devcontainer, the container path being prefixed with \":\" and relative to the workspace folder",
+	Args:  cobra.ExactArgs(2),
+	Run:   devc.Copy,
+}
+
+var editCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit devcontainer configuration",
+}
+
+var editGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a devcontainer setting",
+	Args:  cobra.ExactArgs(1),
+	Run:   devc.EditGet,
+}
+
+var editListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List devcontainer settings",
+	Run:     devc.EditList,
+}
+
+var editSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a devcontainer setting",
+	Args:  cobra.ExactArgs(2),
+	Run:   devc.EditSet,
+}
+
+var featuresCmd = &cobra.Command{
+	Use:   "features",
+	Short: "Manage devcontainer features",
+}
+
+var featuresAddCmd = &cobra.Command{
+	Use:   "add <feature>",
+	Short: "Add a feature to devcontainer configuration",
+	Args:  cobra.ExactArgs(1),
+	Run:   devc.FeaturesAdd,
+}
+
+var forwardCmd = &cobra.Command{
+	Use:    "forward",
+	Short:  "Forward ports to devcontainer",
+	Hidden: true,
+	Run:    devc.Forward,
+}
+
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize devcontainer configuration",
@@ -114,6 +316,12 @@ var listCmd = &cobra.Command{
 	Run:     devc.List,
 }
 
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show devcontainer lifecycle commands or container logs",
+	Run:   devc.Logs,
+}
+
 var manCmd = &cobra.Command{
 	Use:    "man",
 	Short:  "Generate manpage",
@@ -121,6 +329,32 @@ var manCmd = &cobra.Command{
 	Run:    devc.Man,
 }
 
+var portsCmd = &cobra.Command{
+	Use:   "ports",
+	Short: "List forwarded ports",
+	Run:   devc.Ports,
+}
+
+var portsAddCmd = &cobra.Command{
+	Use:   "add <port>",
+	Short: "Add a port to forward to devcontainer configuration",
+	Args:  cobra.ExactArgs(1),
+	Run:   devc.PortsAdd,
+}
+
+var prebuildCmd = &cobra.Command{
+	Use:   "prebuild <image>",
+	Short: "Build devcontainer image with its metadata, to be used by others",
+	Args:  cobra.ExactArgs(1),
+	Run:   devc.Prebuild,
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove stale devcontainers containers and images",
+	Run:   devc.Prune,
+}
+
 var shellCmd = &cobra.Command{
 	Use:   "shell",
 	Short: "Execute a shell inside devcontainer",
@@ -133,44 +367,144 @@ var startCmd = &cobra.Command{
 	Run:   devc.Start,
 }
 
+var statusCmd = &cobra.Command{
+	Use:     "status",
+	Aliases: []string{"inspect"},
+	Short:   "Show devcontainer status",
+	Run:     devc.Status,
+}
+
 var stopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "Stop devcontainer",
 	Run:   devc.Stop,
 }
 
-func (d *DevContainer) PreRun(_ *cobra.Command, _ []string) {
+var volumesCmd = &cobra.Command{
+	Use:   "volumes",
+	Short: "Manage devcontainer named volumes",
+}
+
+var volumesListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List devcontainer named volumes",
+	Run:     devc.VolumesList,
+}
+
+var volumesPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove devcontainer named volumes not used by any container",
+	Run:   devc.VolumesPrune,
+}
+
+var volumesRemoveCmd = &cobra.Command{
+	Use:     "remove <volume>...",
+	Aliases: []string{"rm"},
+	Short:   "Remove devcontainer named volumes",
+	Args:    cobra.MinimumNArgs(1),
+	Run:     devc.VolumesRemove,
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Validate devcontainer configuration",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   devc.Validate,
+}
+
+func (d *DevContainer) PreRun(cmd *cobra.Command, _ []string) {
 	d.SetLogLevel()
-	if lo.None([]string{"completion", "init", "man", "-h", "--help", "help"}, os.Args) {
-		d.ParseConfig()
+	d.Timings.Reset()
+	// relative to the current directory, which the engine changes
+	if path, err := filepath.Abs(timingsTraceFile); err == nil && timingsTraceFile != "" {
+		timingsTraceFile = path
+	}
+	d._ExecCmd = lo.Ternary(rootDryRun, dryRunCmd, execCmd)
+	d.ParseUserConfig(cmd)
+	if cmd.Annotations[devcontainerAnnotation] == "true" {
+		d.ParseConfig(lo.Contains([]string{"build", "start"}, cmd.Name()))
+		// the registry is only looked up before creating the devcontainer
+		d.MergeImageMetadata(lo.Contains([]string{"build", "prebuild", "shell", "start"}, cmd.Name()))
+		d.MergeUserConfig()
 		d.SetAliases()
 		d.NormalizeTypes()
 		d.SetDefaults()
 		d.CheckConfig()
-		d.InitializeCommand()
+		// already run by the command which started the forwarder
+		if cmd.Name() != "forward" {
+			d.InitializeCommand()
+		}
 		d.ResolveVars()
+		d.SetAgentForwarding()
+		d.ComputeHash()
 		d.SetEngine()
 	}
 }
 
 func (d *DevContainer) Build(cmd *cobra.Command, args []string) {
 	if built, _ := d.Engine.IsBuilt(); !built {
-		if _, err := d.Engine.Build(); err != nil {
-			log.Fatal().Err(err).Msg("cannot build")
-		}
+		d.CheckHostRequirements()
+		d.Timings.Time("build", func() {
+			if _, err := d.Engine.Build(); err != nil {
+				log.Fatal().Err(err).Msg("cannot build")
+			}
+		})
 	}
+	d.ReportTimings()
 }
 
 func (d *DevContainer) Init(_ *cobra.Command, _ []string) {
-	if err := os.Mkdir(d.ConfigDir, 0755); err != nil {
-		log.Fatal().Err(err).Msg("cannot create directory")
+	if initList {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tDESCRIPTION")
+		for _, t := range BuiltinTemplates() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", t.ID, t.Name, t.Description)
+		}
+		w.Flush()
+		return
+	}
+
+	workspace, _ := os.Getwd()
+	if _, err := os.Stat(rootConfigDir); err == nil {
+		log.Fatal().Str("directory", rootConfigDir).Msg("devcontainer configuration already exists")
 	}
-	log.Info().Msg("directory created")
-	d.Config.Set("image", "alpine:latest")
-	if err := d.Config.SafeWriteConfigAs(filepath.Join(d.ConfigDir, "devcontainer.json")); err != nil {
-		log.Fatal().Err(err).Msg("cannot write file")
+	template := initTemplate
+	if template == "" {
+		detected, file := DetectTemplate(workspace)
+		template = lo.Ternary(detected != "", detected, defaultTemplate)
+		if detected != "" {
+			log.Info().Str("template", detected).Str("file", file).Msg("template detected, use --template to choose another one")
+		}
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	t, err := LoadTemplate(template, filepath.Join(cacheDir, "devc"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load template")
+	}
+	options, err := t.ResolveOptions(splitOptions(initOptions))
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid template options")
+	}
+	files, err := t.Apply(workspace, rootConfigDir, options)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot apply template")
+	}
+	for _, file := range files {
+		log.Info().Str("file", file).Msg("file created")
+	}
+
+	path := filepath.Join(rootConfigDir, "devcontainer.json")
+	if src, err := os.ReadFile(path); err == nil {
+		errs, warnings := ValidateFile(path, src)
+		for _, e := range append(errs, warnings...) {
+			log.Warn().Msg(e)
+		}
 	}
-	log.Info().Msg("file created")
 }
 
 func (d *DevContainer) List(_ *cobra.Command, _ []string) {
@@ -193,33 +527,82 @@ func (d *DevContainer) Shell(cmd *cobra.Command, args []string) {
 	d.Start(cmd, args)
 	// run post command asynchronously to avoid blocking shell start
 	go d.PostAttachCommand()
-	if _, err := d.Engine.Exec([]string{shellBin}); err != nil {
+	if _, err := d.Engine.Exec([]string{shellBin}, false); err != nil {
 		log.Fatal().Err(err).Msg("cannot execute a shell")
 	}
 }
 
 func (d *DevContainer) Start(cmd *cobra.Command, args []string) {
 	created, _ := d.Engine.IsCreated()
-	if !created {
-		if _, err := d.Engine.Create(); err != nil {
-			log.Fatal().Err(err).Msg("cannot create")
-		}
+	outdated := created && d.IsOutdated()
+	// check before removing or creating anything
+	if !created || (outdated && startAutoRebuild) {
+		d.CheckHostRequirements()
 	}
-	if running, _ := d.Engine.IsRunning(); !running {
-		if _, err := d.Engine.Start(); err != nil {
-			log.Fatal().Err(err).Msg("cannot start")
+	if outdated {
+		if !startAutoRebuild {
+			log.Warn().Msg("configuration changed since devcontainer creation, use --auto-rebuild to recreate it")
+		} else {
+			d.Rebuild()
+			created = false
 		}
+	}
+	if !created {
+		d.Timings.Time("create", func() {
+			if _, err := d.Engine.Create(); err != nil {
+				log.Fatal().Err(err).Msg("cannot create")
+			}
+		})
+	}
+	running, _ := d.Engine.IsRunning()
+	if !running {
+		d.Timings.Time("start", func() {
+			if _, err := d.Engine.Start(); err != nil {
+				log.Fatal().Err(err).Msg("cannot start")
+			}
+		})
+	}
+	// forward ports and agents before running the lifecycle commands
+	d.StartForwarder()
+	if !running {
 		if !created {
+			d.CopyGitConfig()
 			d.OnCreateCommand()
 			// TODO: figure out what updateContentCommand does and add it
 			// go d.UpdateContent()
 			d.PostCreateCommand()
+			d.InstallDotfiles()
 		}
+		d.SetupGpg()
 		d.PostStartCommand()
 	}
+	d.ReportTimings()
+}
+
+// Rebuild remove the outdated container and rebuild its image
+func (d *DevContainer) Rebuild() {
+	log.Info().Msg("configuration changed, rebuilding devcontainer")
+	if running, _ := d.Engine.IsRunning(); running {
+		if _, err := d.Engine.Stop(); err != nil {
+			log.Fatal().Err(err).Msg("cannot stop")
+		}
+	}
+	// keep the volumes, like caches, across rebuilds
+	if _, err := d.Engine.Remove(false); err != nil {
+		log.Fatal().Err(err).Msg("cannot remove")
+	}
+	d.Timings.Time("build", func() {
+		if _, err := d.Engine.Build(); err != nil {
+			log.Fatal().Err(err).Msg("cannot build")
+		}
+	})
 }
 
 func (d *DevContainer) Stop(_ *cobra.Command, _ []string) {
+	if stopVolumes && !stopRemove {
+		log.Fatal().Msg("--volumes requires --remove")
+	}
+	d.StopForwarder()
 	if created, _ := d.Engine.IsCreated(); created {
 		if running, _ := d.Engine.IsRunning(); running {
 			if _, err := d.Engine.Stop(); err != nil {
@@ -227,13 +610,34 @@ func (d *DevContainer) Stop(_ *cobra.Command, _ []string) {
 			}
 		}
 		if stopRemove {
-			if _, err := d.Engine.Remove(); err != nil {
+			if _, err := d.Engine.Remove(stopVolumes); err != nil {
 				log.Fatal().Err(err).Msg("cannot remove")
 			}
 		}
 	}
 }
 
+func (d *DevContainer) Validate(_ *cobra.Command, args []string) {
+	path := filepath.Join(rootConfigDir, "devcontainer.json")
+	if len(args) > 0 {
+		path = args[0]
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot read devcontainer settings")
+	}
+	errs, warnings := ValidateFile(path, src)
+	for _, e := range errs {
+		fmt.Println(e)
+	}
+	for _, w := range warnings {
+		fmt.Println("warning: " + w)
+	}
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+}
+
 // INIT/POST/ON STEPS
 
 func (d *DevContainer) InitializeCommand() {
@@ -246,9 +650,13 @@ func (d *DevContainer) InitializeCommand() {
 	}
 	if len(cmd) > 0 {
 		// execute on the host
-		if _, err := execCmd(cmd, false); err != nil {
-			log.Fatal().Err(err).Msgf("cannot run %s", "initializeCommand")
-		}
+		d.Timings.Time("initializeCommand", func() {
+			start := time.Now()
+			if err := d.execStep("initializeCommand", "", cmd, false); err != nil {
+				d.stepEvent(log.Fatal(), "initializeCommand", "", start, err).Err(err).Msgf("cannot run %s", "initializeCommand")
+			}
+			d.stepEvent(log.Info(), "initializeCommand", "", start, nil).Msg("step finished")
+		})
 	}
 }
 
@@ -265,13 +673,41 @@ func (d *DevContainer) cmd(step string, wait bool) {
 		if wait {
 			time.Sleep(1 * time.Second)
 		}
-		// execute inside the container
-		if _, err := d.Engine.Exec(cmd); err != nil {
-			log.Fatal().Err(err).Msgf("cannot run %s", step)
-		}
+		// execute inside the container, the output of asynchronous steps
+		// only going to their log file to not mix with the shell one
+		d.Timings.Time(step, func() {
+			start := time.Now()
+			container, err := d.containerID()
+			if err == nil {
+				err = d.execStep(step, container, cmd, wait)
+			}
+			if err != nil {
+				if wait {
+					d.stepEvent(log.Error(), step, container, start, err).Err(err).Msgf("cannot run %s, see devc logs --step %s", step, step)
+					return
+				}
+				d.stepEvent(log.Fatal(), step, container, start, err).Err(err).Msgf("cannot run %s", step)
+			}
+			d.stepEvent(log.Info(), step, container, start, nil).Msg("step finished")
+		})
 	}
 }
 
+// add the lifecycle step fields to the log event
+func (d *DevContainer) stepEvent(event *zerolog.Event, step string, container string, start time.Time, err error) *zerolog.Event {
+	event = event.Str("step", step).Dur("duration", time.Since(start)).Int("exit_code", exitCode(err))
+	// the engine is not set yet for initializeCommand
+	if d.Engine == nil || !event.Enabled() {
+		return event.Str("engine", "host")
+	}
+	event = event.Str("engine", lo.Ternary(d.Config.IsSet("dockerComposeFile"), dockerBin+" compose", dockerBin))
+	if container != "" {
+		event = event.Str("container", container)
+	}
+
+	return event
+}
+
 func (d *DevContainer) OnCreateCommand() {
 	d.cmd("onCreateCommand", false)
 }
@@ -1,28 +1,38 @@
 package main
 
 import (
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/samber/lo"
 )
 
 type Docker struct {
-	_ExecCmd        func([]string, bool) (string, error)
+	_ExecCmd        func([]string, bool, ...io.Writer) (string, error)
 	Args            []string
+	BuildHash       string
 	Capabilities    []string
 	Command         []string
 	ContainerUser   string
+	CPUs            float64
 	EnableInit      bool
 	EnablePrivilege bool
 	Envs            []string
+	Hash            string
 	Image           string
 	ImageBuild      DockerImageBuild
+	Instance        string
+	Memory          uint64
 	Mounts          []string
 	Path            string
 	Ports           []string
 	RemoteEnvs      []string
 	RemoteUser      string
+	RunOptions      RunOptions
 	Running         bool
 	SecurityOpts    []string
 	WorkDir         string
@@ -32,7 +42,12 @@ type DockerImageBuild struct {
 	Args       []string
 	Dockerfile string
 	CacheFrom  []string
+	CacheTo    string
 	Context    string
+	Options    []string
+	Platform   string
+	Secrets    []string
+	SSH        []string
 	Tag        string
 	Target     string
 }
@@ -44,7 +59,13 @@ func (d *Docker) Init(c *DevContainer) error {
 	}
 
 	d._ExecCmd = lo.Ternary(d._ExecCmd != nil, d._ExecCmd, execCmd)
-	d.Args = c.Config.GetStringSlice("runArgs")
+	// runArgs which are not translated are passed as they are
+	d.RunOptions, d.Args = ParseRunArgs(c.Config.GetStringSlice("runArgs"))
+	if len(d.Args) > 0 {
+		log.Warn().Strs("args", d.Args).Msg("runArgs not recognised are passed as they are")
+	}
+	d.RunOptions.CapDrop = lo.Uniq(append(c.Config.GetStringSlice("customizations.devc.capDrop"), d.RunOptions.CapDrop...))
+	d.SecurityOpts = c.Config.GetStringSlice("securityOpt")
 	d.Capabilities = c.Config.GetStringSlice("capAdd")
 	d.Command = lo.Ternary(
 		c.Config.GetBool("overrideCommand"),
@@ -52,16 +73,24 @@ func (d *Docker) Init(c *DevContainer) error {
 		nil,
 	)
 	d.ContainerUser = c.Config.GetString("containerUser")
+	cpus, memory, err := c.Resources()
+	if err != nil {
+		return err
+	}
+	d.CPUs = cpus
+	d.Memory = memory
 	d.EnableInit = c.Config.GetBool("init")
 	d.EnablePrivilege = c.Config.GetBool("privileged")
 	d.Envs = lo.MapToSlice(
 		c.Config.GetStringMapString("containerEnv"),
 		func(k string, v string) string { return k + "=" + v },
 	)
+	d.BuildHash = c.BuildHash
+	d.Hash = c.ConfigHash
 	d.Image = lo.Ternary(
 		c.Config.IsSet("image"),
 		c.Config.GetString("image"),
-		"vsc-"+c.WorkingDirectoryName+"-"+md5sum(c.WorkingDirectoryPath),
+		"vsc-"+c.BuildHash[:32],
 	)
 	d.ImageBuild.Args = lo.MapToSlice(
 		c.Config.GetStringMapString("build.args"),
@@ -70,9 +99,27 @@ func (d *Docker) Init(c *DevContainer) error {
 	d.ImageBuild.CacheFrom = c.Config.GetStringSlice("build.cacheFrom")
 	d.ImageBuild.Context = c.Config.GetString("build.context")
 	d.ImageBuild.Dockerfile = c.Config.GetString("build.dockerfile")
+	d.ImageBuild.Options = c.Config.GetStringSlice("build.options")
+	d.ImageBuild.Platform = c.BuildPlatform()
 	d.ImageBuild.Target = c.Config.GetString("build.target")
+	// paths of the configuration are relative to its directory, which is the
+	// current one, and the command line ones to the workspace
+	d.ImageBuild.CacheTo = buildCacheTo(c.Config.GetString("customizations.devc.build.cacheTo"), ".")
+	if buildCacheToFlag != "" {
+		d.ImageBuild.CacheTo = buildCacheTo(buildCacheToFlag, c.WorkingDirectoryPath)
+	}
+	d.ImageBuild.Secrets = append(
+		lo.Map(c.Config.GetStringSlice("customizations.devc.build.secrets"), func(v string, _ int) string { return buildSecret(v, ".") }),
+		lo.Map(buildSecretsFlag, func(v string, _ int) string { return buildSecret(v, c.WorkingDirectoryPath) })...,
+	)
+	d.ImageBuild.SSH = lo.Uniq(append(c.Config.GetStringSlice("customizations.devc.build.ssh"), buildSSHFlag...))
 	d.Mounts = c.Config.GetStringSlice("mounts")
 	d.Mounts = append(d.Mounts, c.Config.GetString("workspaceMount"))
+	d.Instance = c.Instance
+	if d.Instance != "" {
+		name := lo.Ternary(d.RunOptions.Name != "", d.RunOptions.Name, containerName(c.WorkingDirectoryName))
+		d.RunOptions.Name = name + "-" + d.Instance
+	}
 	d.Path = c.WorkingDirectoryPath
 	d.Ports = c.Config.GetStringSlice("forwardPorts")
 	d.RemoteEnvs = lo.MapToSlice(
@@ -94,7 +141,7 @@ func (d *Docker) Init(c *DevContainer) error {
 
 // IsBuilt return the image build status
 func (d *Docker) IsBuilt() (bool, error) {
-	cmdArgs := []string{"docker", "image", "ls"}
+	cmdArgs := []string{dockerBin, "image", "ls"}
 	cmdArgs = append(cmdArgs, "--quiet")
 	cmdArgs = append(cmdArgs, "--format", "{{ .Repository }}")
 	cmdArgs = append(cmdArgs, d.Image)
@@ -104,16 +151,29 @@ func (d *Docker) IsBuilt() (bool, error) {
 	return built, err
 }
 
-// GetContainer return the container name
+// GetImage return the image of the container
+func (d *Docker) GetImage() (string, error) {
+	return d.Image, nil
+}
+
+// GetContainer return the most recent container of the workspace instance
 func (d *Docker) GetContainer(args ...string) (string, error) {
-	cmdArgs := []string{"docker", "container", "ls"}
-	cmdArgs = append(cmdArgs, "--quiet")
-	cmdArgs = append(cmdArgs, "--latest")
+	cmdArgs := []string{dockerBin, "container", "ls"}
+	cmdArgs = append(cmdArgs, "--all")
+	cmdArgs = append(cmdArgs, "--format", `{{ .ID }} {{ .Label "`+instanceLabel+`" }}`)
+	// containers created by older devc versions have no configuration hash
 	cmdArgs = append(cmdArgs, "--filter", "label=devcontainer.local_folder="+d.Path)
-	cmdArgs = append(cmdArgs, "--filter", "ancestor="+d.Image)
 	cmdArgs = append(cmdArgs, args...)
+	out, err := d._ExecCmd(cmdArgs, true)
+	if err != nil {
+		return "", err
+	}
+	// containers are listed from the most recent
+	if containers := filterInstance(out, d.Instance); len(containers) > 0 {
+		return containers[0], nil
+	}
 
-	return d._ExecCmd(cmdArgs, true)
+	return "", nil
 }
 
 // IsCreated return the container creation status
@@ -140,22 +200,97 @@ func (d *Docker) Build() (string, error) {
 	if d.ImageBuild.Dockerfile == "" {
 		return "", nil
 	}
+	// the image is shared with the other worktrees, so it is not labelled
+	// with the workspace folder
+	return d._ExecCmd(d.BuildArgs(d.ImageBuild, d.Image, buildHashLabel+"="+d.BuildHash), false)
+}
 
-	cmdArgs := []string{"docker", "image", "build"}
-	cmdArgs = append(cmdArgs, "--tag", d.Image)
-	cmdArgs = append(cmdArgs, "--file", d.ImageBuild.Dockerfile)
-	if d.ImageBuild.Target != "" {
-		cmdArgs = append(cmdArgs, "--target", d.ImageBuild.Target)
+// BuildArgs return the command line building the image with the given tag and
+// key=value labels, with buildx and loaded into the engine images
+func (d *Docker) BuildArgs(build DockerImageBuild, tag string, labels ...string) []string {
+	cmdArgs := []string{dockerBin, "buildx", "build"}
+	cmdArgs = append(cmdArgs, "--load")
+	cmdArgs = append(cmdArgs, "--tag", tag)
+	for _, label := range labels {
+		cmdArgs = append(cmdArgs, "--label", label)
+	}
+	cmdArgs = append(cmdArgs, "--file", build.Dockerfile)
+	if build.Target != "" {
+		cmdArgs = append(cmdArgs, "--target", build.Target)
+	}
+	if build.Platform != "" {
+		cmdArgs = append(cmdArgs, "--platform", build.Platform)
 	}
-	for _, cache := range d.ImageBuild.CacheFrom {
+	for _, cache := range build.CacheFrom {
 		cmdArgs = append(cmdArgs, "--cache-from", cache)
 	}
-	for _, arg := range d.ImageBuild.Args {
+	if build.CacheTo != "" {
+		cmdArgs = append(cmdArgs, "--cache-to", build.CacheTo)
+		// reuse the exported cache
+		if dest := parseMount(build.CacheTo)["dest"]; dest != "" {
+			if _, err := os.Stat(filepath.Join(dest, "index.json")); err == nil {
+				cmdArgs = append(cmdArgs, "--cache-from", "type=local,src="+dest)
+			}
+		}
+	}
+	for _, arg := range build.Args {
 		cmdArgs = append(cmdArgs, "--build-arg", arg)
 	}
-	cmdArgs = append(cmdArgs, d.ImageBuild.Context)
+	// secrets and ssh agent are only available to the RUN instructions
+	// mounting them, so they are not stored in the image layers
+	for _, secret := range build.Secrets {
+		cmdArgs = append(cmdArgs, "--secret", secret)
+	}
+	for _, ssh := range build.SSH {
+		cmdArgs = append(cmdArgs, "--ssh", ssh)
+	}
+	cmdArgs = append(cmdArgs, build.Options...)
+	cmdArgs = append(cmdArgs, build.Context)
 
-	return d._ExecCmd(cmdArgs, false)
+	return cmdArgs
+}
+
+// return the absolute path, expanding the leading ~ and relative to the given
+// directory otherwise
+func absPath(path string, dir string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(dir, path)
+	}
+
+	return path
+}
+
+// return the --secret value with an absolute source file, a secret from a
+// file being id=name,src=path and from an environment variable id=name,env=VAR
+func buildSecret(secret string, dir string) string {
+	options := strings.Split(secret, ",")
+	for i, option := range options {
+		if key, value, _ := strings.Cut(option, "="); key == "src" || key == "source" {
+			options[i] = key + "=" + absPath(value, dir)
+		}
+	}
+
+	return strings.Join(options, ",")
+}
+
+// return the --cache-to value, a plain path being a local directory
+func buildCacheTo(cache string, dir string) string {
+	if cache == "" {
+		return ""
+	}
+	if !strings.Contains(cache, "=") {
+		return "type=local,dest=" + absPath(cache, dir)
+	}
+	options := parseMount(cache)
+	if options["type"] == "local" && options["dest"] != "" {
+		return strings.Replace(cache, "dest="+options["dest"], "dest="+absPath(options["dest"], dir), 1)
+	}
+
+	return cache
 }
 
 func (d *Docker) createArgs() (cmdArgs []string) {
@@ -177,9 +312,17 @@ func (d *Docker) createArgs() (cmdArgs []string) {
 	for _, env := range d.Envs {
 		cmdArgs = append(cmdArgs, "--env", env)
 	}
+	cmdArgs = append(cmdArgs, d.RunOptions.Args()...)
+	cmdArgs = append(cmdArgs, d.Args...)
 	if d.ContainerUser != "" {
 		cmdArgs = append(cmdArgs, "--user", d.ContainerUser)
 	}
+	if d.CPUs > 0 {
+		cmdArgs = append(cmdArgs, "--cpus", strconv.FormatFloat(d.CPUs, 'f', -1, 64))
+	}
+	if d.Memory > 0 {
+		cmdArgs = append(cmdArgs, "--memory", strconv.FormatUint(d.Memory, 10))
+	}
 	cmdArgs = append(cmdArgs, d.Image)
 
 	return cmdArgs
@@ -187,8 +330,18 @@ func (d *Docker) createArgs() (cmdArgs []string) {
 
 // Create create the container with the given image
 func (d *Docker) Create() (string, error) {
-	cmdArgs := []string{"docker", "container", "create"}
+	if err := d.createVolumes(); err != nil {
+		return "", err
+	}
+	cmdArgs := []string{dockerBin, "container", "create"}
 	cmdArgs = append(cmdArgs, "--label", "devcontainer.local_folder="+d.Path)
+	cmdArgs = append(cmdArgs, "--label", configHashLabel+"="+d.Hash)
+	if d.Instance != "" {
+		cmdArgs = append(cmdArgs, "--label", instanceLabel+"="+d.Instance)
+	}
+	if d.RunOptions.Name != "" {
+		cmdArgs = append(cmdArgs, "--name", d.RunOptions.Name)
+	}
 	cmdArgs = append(cmdArgs, d.createArgs()...)
 	if len(d.Command) > 0 {
 		cmdArgs = append(cmdArgs, d.Command...)
@@ -199,9 +352,8 @@ func (d *Docker) Create() (string, error) {
 
 // Start start the given container
 func (d *Docker) Start() (string, error) {
-	container, _ := d.GetContainer()
-	cmdArgs := []string{"docker", "container", "start"}
-	cmdArgs = append(cmdArgs, d.Args...)
+	container := d.createdContainer()
+	cmdArgs := []string{dockerBin, "container", "start"}
 	cmdArgs = append(cmdArgs, container)
 
 	return d._ExecCmd(cmdArgs, true)
@@ -210,48 +362,96 @@ func (d *Docker) Start() (string, error) {
 // Stop stop the given container
 func (d *Docker) Stop() (string, error) {
 	container, _ := d.GetContainer()
-	cmdArgs := []string{"docker", "container", "stop"}
+	cmdArgs := []string{dockerBin, "container", "stop"}
 	cmdArgs = append(cmdArgs, container)
 
 	return d._ExecCmd(cmdArgs, true)
 }
 
-// Remove remove the container
-func (d *Docker) Remove() (string, error) {
+// Remove remove the container, and its named volumes if asked
+func (d *Docker) Remove(volumes bool) (string, error) {
 	container, _ := d.GetContainer()
-	cmdArgs := []string{"docker", "container", "rm"}
+	cmdArgs := []string{dockerBin, "container", "rm"}
+	if volumes {
+		cmdArgs = append(cmdArgs, "--volumes")
+	}
 	cmdArgs = append(cmdArgs, container)
+	out, err := d._ExecCmd(cmdArgs, true)
+	if err != nil || !volumes {
+		return out, err
+	}
+
+	names, err := d.Volumes()
+	if err != nil || len(names) == 0 {
+		return out, err
+	}
+	cmdArgs = []string{dockerBin, "volume", "rm"}
+	cmdArgs = append(cmdArgs, names...)
 
 	return d._ExecCmd(cmdArgs, true)
 }
 
+// Volumes return the named volumes created for the workspace instance
+func (d *Docker) Volumes(filters ...string) ([]string, error) {
+	cmdArgs := []string{dockerBin, "volume", "ls"}
+	cmdArgs = append(cmdArgs, "--format", `{{ .Name }} {{ .Label "`+instanceLabel+`" }}`)
+	cmdArgs = append(cmdArgs, "--filter", "label=devcontainer.local_folder="+d.Path)
+	cmdArgs = append(cmdArgs, filters...)
+	out, err := d._ExecCmd(cmdArgs, true)
+
+	return filterInstance(out, d.Instance), err
+}
+
+// create the named volumes of the mounts, labelled with the workspace
+func (d *Docker) createVolumes() error {
+	for _, mount := range d.Mounts {
+		options := parseMount(mount)
+		if options["type"] == "bind" || options["type"] == "tmpfs" || options["source"] == "" {
+			continue
+		}
+		cmdArgs := []string{dockerBin, "volume", "create"}
+		cmdArgs = append(cmdArgs, "--label", "devcontainer.local_folder="+d.Path)
+		if d.Instance != "" {
+			cmdArgs = append(cmdArgs, "--label", instanceLabel+"="+d.Instance)
+		}
+		cmdArgs = append(cmdArgs, options["source"])
+		if _, err := d._ExecCmd(cmdArgs, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // List return the list of containers based on the given path
 func (d *Docker) List() (string, error) {
-	cmdArgs := []string{"docker", "container", "ls", "--filter", "label=devcontainer.local_folder=" + d.Path}
+	cmdArgs := []string{dockerBin, "container", "ls", "--filter", "label=devcontainer.local_folder=" + d.Path}
 
 	return d._ExecCmd(cmdArgs, false)
 }
 
 // Run run the given command into a container
 func (d *Docker) Run(command []string) (string, error) {
-	cmdArgs := []string{"docker", "container", "run"}
+	cmdArgs := []string{dockerBin, "container", "run"}
 	cmdArgs = append(cmdArgs, "--interactive", "--tty")
 	cmdArgs = append(cmdArgs, "--workdir", d.WorkDir)
 	if d.RemoteUser != "" {
 		cmdArgs = append(cmdArgs, "--user", d.RemoteUser)
 	}
-	cmdArgs = append(cmdArgs, d.Args...)
 	cmdArgs = append(cmdArgs, d.createArgs()...)
 	cmdArgs = append(cmdArgs, command...)
 
 	return d._ExecCmd(cmdArgs, true)
 }
 
-// Exec execute the given command into the given container
-func (d *Docker) Exec(command []string) (string, error) {
-	container, _ := d.GetContainer()
-	cmdArgs := []string{"docker", "container", "exec"}
-	cmdArgs = append(cmdArgs, "--interactive", "--tty")
+// ExecArgs return the command line executing the given command into the container
+func (d *Docker) ExecArgs(command []string, tty bool) []string {
+	container := d.createdContainer()
+	cmdArgs := []string{dockerBin, "container", "exec"}
+	cmdArgs = append(cmdArgs, "--interactive")
+	if tty {
+		cmdArgs = append(cmdArgs, "--tty")
+	}
 	cmdArgs = append(cmdArgs, "--workdir", d.WorkDir)
 	if d.RemoteUser != "" {
 		cmdArgs = append(cmdArgs, "--user", d.RemoteUser)
@@ -264,6 +464,102 @@ func (d *Docker) Exec(command []string) (string, error) {
 	cmdArgs = append(cmdArgs, container)
 	cmdArgs = append(cmdArgs, command...)
 
+	return cmdArgs
+}
+
+// Exec execute the given command into the given container, without a tty when
+// the output is captured
+func (d *Docker) Exec(command []string, capture bool) (string, error) {
+	return d._ExecCmd(d.ExecArgs(command, !capture), capture)
+}
+
+// Inspect return information about the container in the given format
+func (d *Docker) Inspect(format string) (string, error) {
+	container, err := d.GetContainer()
+	if err != nil {
+		return "", err
+	}
+	if container == "" {
+		return "", errors.New("container not found")
+	}
+	cmdArgs := []string{dockerBin, "container", "inspect"}
+	cmdArgs = append(cmdArgs, "--format", format)
+	cmdArgs = append(cmdArgs, container)
+
+	return d._ExecCmd(cmdArgs, true)
+}
+
+// return the container, failing if it does not exist, except in dry-run mode
+func (d *Docker) container() (string, error) {
+	container, err := d.GetContainer()
+	if err != nil {
+		return "", err
+	}
+	if container == "" && rootDryRun {
+		return dryRunContainer, nil
+	}
+	if container == "" {
+		return "", errors.New("container not found")
+	}
+
+	return container, nil
+}
+
+// return the container created by the previous steps, or a placeholder in
+// dry-run mode, where it is not created
+func (d *Docker) createdContainer() string {
+	container, _ := d.GetContainer()
+	if container == "" && rootDryRun {
+		return dryRunContainer
+	}
+
+	return container
+}
+
+// Logs show the container logs
+func (d *Docker) Logs(follow bool) (string, error) {
+	container, err := d.container()
+	if err != nil {
+		return "", err
+	}
+	cmdArgs := []string{dockerBin, "container", "logs"}
+	if follow {
+		cmdArgs = append(cmdArgs, "--follow")
+	}
+	cmdArgs = append(cmdArgs, container)
+
+	return d._ExecCmd(cmdArgs, false)
+}
+
+// Copy copy files between the host and the container, the container path
+// being prefixed with ":"
+func (d *Docker) Copy(src string, dst string) (string, error) {
+	container, err := d.container()
+	if err != nil {
+		return "", err
+	}
+	cmdArgs := []string{dockerBin, "container", "cp"}
+	for _, path := range []string{src, dst} {
+		if strings.HasPrefix(path, ":") {
+			path = container + path
+		}
+		cmdArgs = append(cmdArgs, path)
+	}
+
+	return d._ExecCmd(cmdArgs, false)
+}
+
+// Chown give the container path to the user
+func (d *Docker) Chown(path string, user string) (string, error) {
+	container, err := d.container()
+	if err != nil {
+		return "", err
+	}
+	cmdArgs := []string{dockerBin, "container", "exec"}
+	cmdArgs = append(cmdArgs, "--user", "root")
+	cmdArgs = append(cmdArgs, container)
+	cmdArgs = append(cmdArgs, "chown", "-R", chownOwner(user), path)
+
 	return d._ExecCmd(cmdArgs, false)
 }
 
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
+	"io"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/samber/lo"
@@ -9,11 +12,14 @@ import (
 
 // DockerCompose type
 type DockerCompose struct {
-	_ExecCmd    func([]string, bool) (string, error)
+	_ExecCmd    func([]string, bool, ...io.Writer) (string, error)
 	Command     []string
 	Containers  []string
 	Envs        []string
 	Files       []string
+	Instance    string
+	Override    map[string]interface{}
+	Path        string
 	ProjectName string
 	Running     bool
 	RunServices []string
@@ -23,7 +29,7 @@ type DockerCompose struct {
 }
 
 func (d *DockerCompose) cmd(args ...string) []string {
-	cmd := []string{"docker", "compose", "--project-name", d.ProjectName}
+	cmd := []string{dockerBin, "compose", "--project-name", d.ProjectName}
 	for _, file := range d.Files {
 		cmd = append(cmd, "--file", file)
 	}
@@ -43,12 +49,82 @@ func (d *DockerCompose) Init(c *DevContainer) error {
 		c.Config.GetStringSlice("dockerComposeFile"),
 		func(v string, _ int) string { return filepath.Join(c.ConfigDir, v) },
 	)
-	d.ProjectName = c.Config.GetString("name") + "_devcontainer"
+	d.Instance = c.Instance
+	d.Path = c.WorkingDirectoryPath
+	// instances are isolated in their own project
+	d.ProjectName = c.Config.GetString("name") + lo.Ternary(d.Instance != "", "_"+d.Instance, "") + "_devcontainer"
 	d.RunServices = c.Config.GetStringSlice("runServices")
 	d.Service = c.Config.GetString("service")
 	d.User = c.Config.GetString("remoteUser")
 	d.WorkDir = c.Config.GetString("workspaceFolder")
 
+	// settings that are not part of the compose files are passed through an
+	// override file
+	d.Override = map[string]interface{}{
+		"labels": d.labels(configHashLabel + "=" + c.ConfigHash),
+	}
+	if caps := c.Config.GetStringSlice("capAdd"); len(caps) > 0 {
+		d.Override["cap_add"] = caps
+	}
+	if opts := c.Config.GetStringSlice("securityOpt"); len(opts) > 0 {
+		d.Override["security_opt"] = opts
+	}
+	// named volumes must be declared, with their name to not be prefixed by
+	// the project name
+	volumes := map[string]interface{}{}
+	if mounts := c.Config.GetStringSlice("mounts"); len(mounts) > 0 {
+		d.Override["volumes"] = lo.Map(mounts, func(v string, _ int) map[string]interface{} { return composeVolume(v) })
+		for _, mount := range mounts {
+			if options := parseMount(mount); options["type"] != "bind" && options["type"] != "tmpfs" && options["source"] != "" {
+				volumes[options["source"]] = map[string]interface{}{
+					"name":   options["source"],
+					"labels": d.labels(),
+				}
+			}
+		}
+	}
+	cpus, memory, err := c.Resources()
+	if err != nil {
+		return err
+	}
+	if cpus > 0 {
+		d.Override["cpus"] = cpus
+	}
+	if memory > 0 {
+		d.Override["mem_limit"] = memory
+	}
+	options, unsupported := ParseRunArgs(c.Config.GetStringSlice("runArgs"))
+	options.CapDrop = lo.Uniq(append(c.Config.GetStringSlice("customizations.devc.capDrop"), options.CapDrop...))
+	if options.Name != "" && d.Instance != "" {
+		options.Name += "-" + d.Instance
+	}
+	if len(unsupported) > 0 {
+		log.Warn().Strs("args", unsupported).Msg("runArgs not supported with compose are ignored")
+	}
+	if c.Config.IsSet("customizations.devc.build") || buildCacheToFlag != "" || buildPlatformFlag != "" || len(buildSecretsFlag) > 0 || len(buildSSHFlag) > 0 {
+		log.Warn().Msg("build options are not supported with compose and are ignored, set them in the compose files")
+	}
+	// the override file is not next to the compose files
+	options.EnvFiles = lo.Map(options.EnvFiles, func(v string, _ int) string {
+		path, _ := filepath.Abs(filepath.Join(c.ConfigDir, v))
+		return lo.Ternary(filepath.IsAbs(v), v, path)
+	})
+	networks := options.Compose(d.Override)
+	override := filepath.Join(c.StateDir(), "docker-compose.override.json")
+	content := map[string]interface{}{
+		"services": map[string]interface{}{d.Service: d.Override},
+	}
+	if len(networks) > 0 {
+		content["networks"] = networks
+	}
+	if len(volumes) > 0 {
+		content["volumes"] = volumes
+	}
+	if err := writeJSON(override, content); err != nil {
+		return err
+	}
+	d.Files = append(d.Files, override)
+
 	// check if already started
 	if running, err := d.IsRunning(); err != nil {
 		return err
@@ -59,6 +135,24 @@ func (d *DockerCompose) Init(c *DevContainer) error {
 	return nil
 }
 
+// convert a --mount string to the compose volume long syntax
+func composeVolume(mount string) map[string]interface{} {
+	// the engine default type is volume
+	volume := map[string]interface{}{"type": "volume"}
+	for key, value := range parseMount(mount) {
+		switch key {
+		case "type", "source", "target", "consistency":
+			if value != "" {
+				volume[key] = value
+			}
+		case "readonly":
+			volume["read_only"] = value == "" || value == "true" || value == "1"
+		}
+	}
+
+	return volume
+}
+
 // IsBuilt return the image build status
 func (d *DockerCompose) IsBuilt() (bool, error) {
 	cmdArgs := d.cmd("images")
@@ -70,6 +164,20 @@ func (d *DockerCompose) IsBuilt() (bool, error) {
 	return built, err
 }
 
+// GetImage return the image of the service container
+func (d *DockerCompose) GetImage() (string, error) {
+	cmdArgs := d.cmd("images")
+	cmdArgs = append(cmdArgs, "--quiet")
+	cmdArgs = append(cmdArgs, d.Service)
+	out, err := d._ExecCmd(cmdArgs, true)
+	if err != nil {
+		return "", err
+	}
+	image, _, _ := strings.Cut(out, "\n")
+
+	return image, nil
+}
+
 // IsCreated return the container creation status
 func (d *DockerCompose) IsCreated() (bool, error) {
 	cmdArgs := d.cmd("ps")
@@ -133,13 +241,59 @@ func (d *DockerCompose) Stop() (string, error) {
 	return d._ExecCmd(cmdArgs, false)
 }
 
-// Remove remove the given container
-func (d *DockerCompose) Remove() (string, error) {
-	cmdArgs := d.cmd("down", "--volumes")
+// Remove remove the given container, and the named volumes if asked
+func (d *DockerCompose) Remove(volumes bool) (string, error) {
+	cmdArgs := d.cmd("down")
+	if volumes {
+		cmdArgs = append(cmdArgs, "--volumes")
+	}
 
 	return d._ExecCmd(cmdArgs, false)
 }
 
+// return the labels of the workspace instance resources, with the given
+// key=value ones
+func (d *DockerCompose) labels(labels ...string) map[string]string {
+	m := map[string]string{"devcontainer.local_folder": d.Path}
+	if d.Instance != "" {
+		m[instanceLabel] = d.Instance
+	}
+	for _, label := range labels {
+		key, value, _ := strings.Cut(label, "=")
+		m[key] = value
+	}
+
+	return m
+}
+
+// Volumes return the named volumes of the compose project and the ones
+// created for the workspace instance
+func (d *DockerCompose) Volumes(filters ...string) ([]string, error) {
+	// compose normalizes the project name, which is specific to the instance
+	project := regexp.MustCompile(`[^a-z0-9_-]`).ReplaceAllString(strings.ToLower(d.ProjectName), "")
+	cmdArgs := []string{dockerBin, "volume", "ls"}
+	cmdArgs = append(cmdArgs, "--quiet")
+	cmdArgs = append(cmdArgs, "--filter", "label=com.docker.compose.project="+project)
+	cmdArgs = append(cmdArgs, filters...)
+	out, err := d._ExecCmd(cmdArgs, true)
+	if err != nil {
+		return nil, err
+	}
+	volumes := lo.Filter(strings.Split(out, "\n"), func(x string, _ int) bool { return x != "" })
+
+	cmdArgs = []string{dockerBin, "volume", "ls"}
+	cmdArgs = append(cmdArgs, "--format", `{{ .Name }} {{ .Label "`+instanceLabel+`" }}`)
+	cmdArgs = append(cmdArgs, "--filter", "label=devcontainer.local_folder="+d.Path)
+	cmdArgs = append(cmdArgs, filters...)
+	out, err = d._ExecCmd(cmdArgs, true)
+	if err != nil {
+		return nil, err
+	}
+	volumes = append(volumes, filterInstance(out, d.Instance)...)
+
+	return lo.Uniq(volumes), nil
+}
+
 // List return the list of containers based on the given path
 func (d *DockerCompose) List() (string, error) {
 	cmdArgs := d.cmd("ls")
@@ -160,9 +314,12 @@ func (d *DockerCompose) Run(command []string) (string, error) {
 	return d._ExecCmd(cmdArgs, true)
 }
 
-// Exec execute the given command into the given container
-func (d *DockerCompose) Exec(command []string) (string, error) {
+// ExecArgs return the command line executing the given command into the service container
+func (d *DockerCompose) ExecArgs(command []string, tty bool) []string {
 	cmdArgs := d.cmd("exec")
+	if !tty {
+		cmdArgs = append(cmdArgs, "--no-TTY")
+	}
 	cmdArgs = append(cmdArgs, "--workdir", d.WorkDir)
 	if d.User != "" {
 		cmdArgs = append(cmdArgs, "--user", d.User)
@@ -175,6 +332,73 @@ func (d *DockerCompose) Exec(command []string) (string, error) {
 	cmdArgs = append(cmdArgs, d.Service)
 	cmdArgs = append(cmdArgs, command...)
 
+	return cmdArgs
+}
+
+// Exec execute the given command into the given container, without a tty when
+// the output is captured
+func (d *DockerCompose) Exec(command []string, capture bool) (string, error) {
+	return d._ExecCmd(d.ExecArgs(command, !capture), capture)
+}
+
+// Inspect return information about the service container in the given format
+func (d *DockerCompose) Inspect(format string) (string, error) {
+	return d.InspectService(d.Service, format)
+}
+
+// InspectService return information about the given service container in the
+// given format
+func (d *DockerCompose) InspectService(service string, format string) (string, error) {
+	cmdArgs := d.cmd("ps")
+	cmdArgs = append(cmdArgs, "--quiet")
+	cmdArgs = append(cmdArgs, service)
+	container, err := d._ExecCmd(cmdArgs, true)
+	if err != nil {
+		return "", err
+	}
+	if container == "" {
+		return "", errors.New("container not found")
+	}
+	cmdArgs = []string{dockerBin, "container", "inspect"}
+	cmdArgs = append(cmdArgs, "--format", format)
+	cmdArgs = append(cmdArgs, container)
+
+	return d._ExecCmd(cmdArgs, true)
+}
+
+// Logs show the service container logs
+func (d *DockerCompose) Logs(follow bool) (string, error) {
+	cmdArgs := d.cmd("logs")
+	if follow {
+		cmdArgs = append(cmdArgs, "--follow")
+	}
+	cmdArgs = append(cmdArgs, d.Service)
+
+	return d._ExecCmd(cmdArgs, false)
+}
+
+// Copy copy files between the host and the service container, the container
+// path being prefixed with ":"
+func (d *DockerCompose) Copy(src string, dst string) (string, error) {
+	cmdArgs := d.cmd("cp")
+	for _, path := range []string{src, dst} {
+		if strings.HasPrefix(path, ":") {
+			path = d.Service + path
+		}
+		cmdArgs = append(cmdArgs, path)
+	}
+
+	return d._ExecCmd(cmdArgs, false)
+}
+
+// Chown give the service container path to the user
+func (d *DockerCompose) Chown(path string, user string) (string, error) {
+	cmdArgs := d.cmd("exec")
+	cmdArgs = append(cmdArgs, "--no-TTY")
+	cmdArgs = append(cmdArgs, "--user", "root")
+	cmdArgs = append(cmdArgs, d.Service)
+	cmdArgs = append(cmdArgs, "chown", "-R", chownOwner(user), path)
+
 	return d._ExecCmd(cmdArgs, false)
 }
 
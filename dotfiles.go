@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// scripts looked up in the dotfiles repository when no install command is set
+var dotfilesInstallScripts = []string{"install.sh", "bootstrap.sh", "setup.sh"}
+
+// return the container path as a shell word, expanding the leading ~
+func containerPath(path string) string {
+	if path == "~" {
+		return `"$HOME"`
+	}
+	if strings.HasPrefix(path, "~/") {
+		return `"$HOME"/` + shellQuote(strings.TrimPrefix(path, "~/"))
+	}
+
+	return shellQuote(path)
+}
+
+// return the local path of the repository, relative to the given directory,
+// if it is not a remote one
+func localRepository(repository string, dir string) (string, bool) {
+	path := strings.TrimPrefix(repository, "file://")
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if strings.HasPrefix(repository, "file://") {
+		return path, true
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, true
+	}
+
+	return "", false
+}
+
+// InstallDotfiles clone the dotfiles repository into the container and run
+// its install script
+func (d *DevContainer) InstallDotfiles() {
+	repository := startDotfilesRepository
+	if repository == "" {
+		return
+	}
+	target := containerPath(startDotfilesTargetPath)
+
+	if path, ok := localRepository(repository, d.WorkingDirectoryPath); ok {
+		// the container cannot reach the host filesystem, the repository is
+		// cloned on the host then copied into the container
+		tmpDir, err := os.MkdirTemp("", "devc-dotfiles-")
+		if err != nil {
+			log.Error().Err(err).Msg("cannot clone dotfiles")
+			return
+		}
+		defer os.RemoveAll(tmpDir)
+		clone := filepath.Join(tmpDir, "dotfiles")
+		if _, err := d._ExecCmd([]string{"git", "clone", "--depth", "1", "file://" + path, clone}, false); err != nil {
+			log.Error().Err(err).Msg("cannot clone dotfiles")
+			return
+		}
+		dst, err := d.Engine.Exec([]string{"sh", "-c", "echo " + target}, true)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot resolve dotfiles target path")
+			return
+		}
+		if err := copyToContainer(d.Engine, clone, dst); err != nil {
+			log.Error().Err(err).Msg("cannot copy dotfiles")
+			return
+		}
+	} else {
+		// github shorthand: owner/repository
+		if regexp.MustCompile(`^[[:word:].-]+/[[:word:].-]+$`).MatchString(repository) {
+			repository = "https://github.com/" + repository + ".git"
+		}
+		script := "git clone --depth 1 " + shellQuote(repository) + " " + target
+		if _, err := d.Engine.Exec([]string{"sh", "-c", script}, false); err != nil {
+			log.Error().Err(err).Msg("cannot clone dotfiles")
+			return
+		}
+	}
+
+	script := "cd " + target + " || exit 1\n"
+	if startDotfilesInstallCommand != "" {
+		script += startDotfilesInstallCommand
+	} else {
+		script += `for f in ` + strings.Join(dotfilesInstallScripts, " ") + `; do
+  if [ -f "$f" ]; then chmod +x "$f"; exec "./$f"; fi
+done
+echo "no install script found in dotfiles repository" >&2`
+	}
+	if _, err := d.Engine.Exec([]string{"sh", "-c", script}, false); err != nil {
+		log.Error().Err(err).Msg("cannot install dotfiles")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// directory where the features are copied to be installed in the image
+const featuresInstallDir = "/tmp/devc-features"
+
+// FeatureOption is an option declared by devcontainer-feature.json
+type FeatureOption struct {
+	Type    string      `json:"type"`
+	Default interface{} `json:"default"`
+}
+
+// Feature is a devcontainer feature installed into prebuilt images, cf.
+// https://containers.dev/implementors/features/
+type Feature struct {
+	ID           string                   `json:"id"`
+	Version      string                   `json:"version"`
+	Options      map[string]FeatureOption `json:"options"`
+	ContainerEnv map[string]string        `json:"containerEnv"`
+	Ref          string                   `json:"-"`
+	Values       interface{}              `json:"-"`
+	settings     map[string]interface{}
+}
+
+// LoadFeature fetch the feature from a directory relative to the configuration
+// one, or from an OCI reference, into the given directory
+func LoadFeature(ref string, configDir string, dir string) (*Feature, error) {
+	if strings.HasPrefix(ref, "./") || strings.HasPrefix(ref, "../") {
+		reader, writer := io.Pipe()
+		go func() { writer.CloseWithError(tarDir(filepath.Join(configDir, ref), writer)) }()
+		if err := untar(reader, dir); err != nil {
+			return nil, err
+		}
+	} else {
+		ociRef, err := ParseOCIRef(ref)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported feature %q, only local directories and OCI references are", ref)
+		}
+		log.Info().Str("feature", ociRef.String()).Msg("pulling feature")
+		if err := NewOCIRegistry().Pull(ociRef, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "devcontainer-feature.json"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read feature metadata: %w", err)
+	}
+	f := &Feature{Ref: ref}
+	if err := json.Unmarshal(content, f); err != nil {
+		return nil, fmt.Errorf("cannot parse feature metadata: %w", err)
+	}
+	if err := json.Unmarshal(content, &f.settings); err != nil {
+		return nil, fmt.Errorf("cannot parse feature metadata: %w", err)
+	}
+
+	return f, nil
+}
+
+// MetadataEntry return the entry of the feature in the image metadata, its
+// containerEnv being set by the image itself
+func (f *Feature) MetadataEntry() map[string]interface{} {
+	entry := lo.PickByKeys(f.settings, lo.Without(metadataProperties, "containerEnv"))
+	entry["id"] = f.Ref
+
+	return entry
+}
+
+// InstallEnv return the variables passed to install.sh, the configured options
+// completed with their defaults, a string value setting the version
+func (f *Feature) InstallEnv() map[string]string {
+	values := map[string]interface{}{}
+	switch v := f.Values.(type) {
+	case map[string]interface{}:
+		values = v
+	case string:
+		values["version"] = v
+	}
+
+	env := map[string]string{}
+	for name, option := range f.Options {
+		if option.Default != nil {
+			env[featureOptionEnv(name)] = fmt.Sprint(option.Default)
+		}
+	}
+	for name, value := range values {
+		env[featureOptionEnv(name)] = fmt.Sprint(value)
+	}
+
+	return env
+}
+
+// return the variable of the option, as named by the specification
+func featureOptionEnv(name string) string {
+	name = regexp.MustCompile(`[^\w]`).ReplaceAllString(name, "_")
+	name = regexp.MustCompile(`^[\d_]+`).ReplaceAllString(name, "_")
+
+	return strings.ToUpper(name)
+}
+
+// return the feature reference without its version
+func featureID(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+
+	return ref
+}
+
+// sort the feature references by name, the ones listed without their version
+// by overrideFeatureInstallOrder coming first
+func sortFeatures(refs []string, order []string) []string {
+	sorted := append([]string{}, refs...)
+	rank := func(ref string) int {
+		if i := lo.IndexOf(order, featureID(ref)); i >= 0 {
+			return i
+		}
+		return len(order)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if rank(sorted[i]) != rank(sorted[j]) {
+			return rank(sorted[i]) < rank(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	return sorted
+}
+
+// return the Dockerfile installing the features, fetched into the features
+// directory of the build context, on top of the base image, as root and with
+// the users given to their install.sh
+func featuresDockerfile(base string, imageUser string, containerUser string, remoteUser string, features []*Feature) string {
+	home := func(user string) string {
+		return `"$(awk -F: -v u=` + shellQuote(user) + ` '$1 == u { print $6 }' /etc/passwd)"`
+	}
+	lines := []string{"FROM " + base, "USER root"}
+	for i, f := range features {
+		dir := fmt.Sprintf("%s/%d", featuresInstallDir, i)
+		vars := []string{
+			"_CONTAINER_USER=" + shellQuote(containerUser),
+			"_CONTAINER_USER_HOME=" + home(containerUser),
+			"_REMOTE_USER=" + shellQuote(remoteUser),
+			"_REMOTE_USER_HOME=" + home(remoteUser),
+		}
+		env := f.InstallEnv()
+		for _, name := range lo.Keys(env) {
+			vars = append(vars, name+"="+shellQuote(env[name]))
+		}
+		sort.Strings(vars[4:])
+		lines = append(lines,
+			fmt.Sprintf("COPY features/%d %s", i, dir),
+			fmt.Sprintf("RUN cd %s && chmod +x install.sh && %s ./install.sh", dir, strings.Join(vars, " ")),
+		)
+		names := lo.Keys(f.ContainerEnv)
+		sort.Strings(names)
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("ENV %s=%q", name, f.ContainerEnv[name]))
+		}
+	}
+	lines = append(lines, "RUN rm -rf "+featuresInstallDir, "USER "+imageUser)
+
+	return strings.Join(lines, "\n") + "\n"
+}
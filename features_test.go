@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFeatureInstallEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		values interface{}
+		want   map[string]string
+	}{
+		{"defaults", map[string]interface{}{}, map[string]string{"VERSION": "latest", "INSTALLTOOLS": "true"}},
+		{"configured", map[string]interface{}{"installTools": false}, map[string]string{"VERSION": "latest", "INSTALLTOOLS": "false"}},
+		{"version shorthand", "1.21", map[string]string{"VERSION": "1.21", "INSTALLTOOLS": "true"}},
+		{"option names", map[string]interface{}{"go-proxy": "direct", "2fa": true}, map[string]string{"VERSION": "latest", "INSTALLTOOLS": "true", "GO_PROXY": "direct", "_FA": "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Feature{
+				Options: map[string]FeatureOption{
+					"version":      {Type: "string", Default: "latest"},
+					"installTools": {Type: "boolean", Default: true},
+					"proxy":        {Type: "string"},
+				},
+				Values: tt.values,
+			}
+			if got := f.InstallEnv(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("InstallEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortFeatures(t *testing.T) {
+	tests := []struct {
+		name  string
+		refs  []string
+		order []string
+		want  []string
+	}{
+		{"by name", []string{"ghcr.io/b:1", "./local", "ghcr.io/a:1"}, nil, []string{"./local", "ghcr.io/a:1", "ghcr.io/b:1"}},
+		{"overridden", []string{"ghcr.io/b:1", "./local", "ghcr.io/a:1"}, []string{"ghcr.io/b", "./local"}, []string{"ghcr.io/b:1", "./local", "ghcr.io/a:1"}},
+		{"digest", []string{"ghcr.io/b@sha256:1234", "ghcr.io/a:1"}, []string{"ghcr.io/b"}, []string{"ghcr.io/b@sha256:1234", "ghcr.io/a:1"}},
+		{"registry port", []string{"localhost:5000/b", "localhost:5000/a"}, []string{"localhost:5000/b"}, []string{"localhost:5000/b", "localhost:5000/a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sortFeatures(tt.refs, tt.order); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("sortFeatures() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
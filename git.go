@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// name of the git credential socket in the agent directory
+const gitCredentialSocket = "git-credential.sock"
+
+// git credential helper forwarding the get requests to the host through the
+// socket, with the git credential-cache client
+const gitCredentialHelper = `!f() { test "$1" != get || exec git credential-cache --socket ` + containerAgentDir + "/" + gitCredentialSocket + ` get; }; f`
+
+// git settings which refer to host paths or programs
+var gitConfigExcludes = []string{
+	"commit.template",
+	"core.askpass",
+	"core.attributesfile",
+	"core.excludesfile",
+	"core.fsmonitor",
+	"core.hookspath",
+	"core.sshcommand",
+	"credential.",
+	"gpg.",
+	"http.sslcainfo",
+	"http.sslcert",
+	"http.sslkey",
+	"include.",
+	"includeif.",
+	"safe.directory",
+}
+
+// CopyGitConfig copy the host global git settings into the container and
+// install a credential helper forwarding requests to the host
+func (d *DevContainer) CopyGitConfig() {
+	if !d.Config.GetBool("customizations.devc.copyGitConfig") {
+		return
+	}
+
+	out, err := execCmd([]string{"git", "config", "--global", "--list", "--null"}, true)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot read git config")
+		return
+	}
+
+	// entries are separated by NUL, keys and values by a newline
+	script := []string{"command -v git >/dev/null 2>&1 || { echo 'git is not installed' >&2; exit 0; }"}
+	unset := []string{}
+	for _, entry := range strings.Split(out, "\x00") {
+		key, value, _ := strings.Cut(entry, "\n")
+		if key == "" || lo.SomeBy(gitConfigExcludes, func(x string) bool { return strings.HasPrefix(key, x) }) {
+			continue
+		}
+		if !lo.Contains(unset, key) {
+			script = append(script, shellJoin([]string{"git", "config", "--global", "--unset-all", key}))
+			unset = append(unset, key)
+		}
+		script = append(script, shellJoin([]string{"git", "config", "--global", "--add", key, value}))
+	}
+	script = append(script, shellJoin([]string{"git", "config", "--global", "credential.helper", gitCredentialHelper}))
+
+	if out, err := d.Engine.Exec([]string{"sh", "-c", strings.Join(script, "\n")}, true); err != nil {
+		log.Error().Err(err).Str("output", out).Msg("cannot copy git config")
+	}
+}
+
+// ServeGitCredentials listen on the git credential socket and answer the
+// requests of the container credential helper with the host credential helpers
+func (f *Forwarder) ServeGitCredentials() error {
+	path := filepath.Join(f.devc.AgentDir(), gitCredentialSocket)
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	// only the host user, and the remote user sharing its uid, can use the
+	// host credentials
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	log.Info().Str("socket", path).Msg("git credentials forwarded")
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Error().Err(err).Str("socket", path).Msg("cannot accept connection")
+				return
+			}
+			go serveGitCredential(conn)
+		}
+	}()
+
+	return nil
+}
+
+// answer a request of git credential-cache: "action" and "timeout" lines,
+// then the credential attributes until the client closes its side
+func serveGitCredential(conn net.Conn) {
+	defer conn.Close()
+	request, err := io.ReadAll(conn)
+	if err != nil {
+		log.Debug().Err(err).Msg("cannot read git credential request")
+		return
+	}
+
+	operation := ""
+	attributes := []string{}
+	for _, line := range strings.Split(string(request), "\n") {
+		switch {
+		case strings.HasPrefix(line, "action="):
+			operation = strings.TrimPrefix(line, "action=")
+		case strings.HasPrefix(line, "timeout="), line == "":
+		default:
+			attributes = append(attributes, line)
+		}
+	}
+	if operation != "get" {
+		return
+	}
+	io.WriteString(conn, gitCredential(attributes))
+}
+
+// fill the credential with the given attributes from the host credential
+// helpers
+func gitCredential(attributes []string) string {
+	log.Debug().Msg("git credential request")
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdin = strings.NewReader(strings.Join(attributes, "\n") + "\n\n")
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		log.Debug().Err(err).Msg("git credential request failed")
+		return ""
+	}
+
+	return stdout.String()
+}
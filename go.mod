@@ -7,7 +7,6 @@ require (
 	github.com/samber/lo v1.38.1
 	github.com/spf13/cobra v1.7.0
 	github.com/spf13/viper v1.16.0
-	muzzammil.xyz/jsonc v1.0.0
 )
 
 require (
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// label used to store the configuration hash on images and containers
+const configHashLabel = "devcontainer.config_hash"
+
+// label of the images with the hash of their build settings, the images being
+// shared by the worktrees of a repository
+const buildHashLabel = "devcontainer.build_hash"
+
+// label used to store the instance name on containers and volumes
+const instanceLabel = "devcontainer.instance"
+
+// ComputeHash compute a hash over the resolved configuration and the files it
+// references, to detect configuration drift
+func (d *DevContainer) ComputeHash() {
+	hasher := sha256.New()
+
+	// resolved configuration, including features
+	settings, err := json.Marshal(d.Config.AllSettings())
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot hash configuration")
+	}
+	hasher.Write(settings)
+
+	// dockerfile and the build context files it copies
+	d.BuildHash = d.computeBuildHash()
+	io.WriteString(hasher, d.BuildHash)
+
+	// compose files
+	for _, file := range d.Config.GetStringSlice("dockerComposeFile") {
+		path := filepath.Join(d.ConfigDir, file)
+		hashFile(hasher, path, path)
+	}
+
+	d.ConfigHash = hex.EncodeToString(hasher.Sum(nil))
+	log.Debug().Str("hash", d.ConfigHash).Str("build_hash", d.BuildHash).Msg("configuration hash")
+}
+
+// compute a hash over the build settings and the files they use, which does
+// not depend on the workspace path, so that the worktrees of a repository
+// share their images
+func (d *DevContainer) computeBuildHash() string {
+	hasher := sha256.New()
+	settings, err := json.Marshal(d.Config.AllSettings()["build"])
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot hash build configuration")
+	}
+	hasher.Write(settings)
+	io.WriteString(hasher, d.BuildPlatform())
+	if d.Config.IsSet("build.dockerfile") {
+		dockerfile := filepath.Join(d.ConfigDir, d.Config.GetString("build.dockerfile"))
+		context := filepath.Join(d.ConfigDir, d.Config.GetString("build.context"))
+		// files are named relatively to the configuration directory
+		for _, file := range append([]string{dockerfile}, dockerfileSources(dockerfile, context)...) {
+			name, err := filepath.Rel(d.ConfigDir, file)
+			if err != nil {
+				name = file
+			}
+			hashFile(hasher, file, name)
+		}
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// IsOutdated return true if the container has been created from another
+// configuration than the current one
+func (d *DevContainer) IsOutdated() bool {
+	hash, err := d.Engine.Inspect(`{{ index .Config.Labels "` + configHashLabel + `" }}`)
+	// containers created before hashes were stored cannot be compared
+	if err != nil || hash == "" || hash == "<no value>" {
+		return false
+	}
+
+	return hash != d.ConfigHash
+}
+
+// BuildPlatform return the platform to build the image for, empty for the
+// engine one
+func (d *DevContainer) BuildPlatform() string {
+	if buildPlatformFlag != "" {
+		return buildPlatformFlag
+	}
+
+	return d.Config.GetString("customizations.devc.build.platform")
+}
+
+// write the file name and content into the hasher
+func hashFile(w io.Writer, path string, name string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Debug().Err(err).Str("file", path).Msg("cannot hash file")
+		return
+	}
+	defer f.Close()
+	io.WriteString(w, filepath.ToSlash(name))
+	io.Copy(w, f)
+}
+
+// return the instructions of the Dockerfile, with continued lines joined
+func dockerfileInstructions(dockerfile string) []string {
+	f, err := os.Open(dockerfile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	instructions := []string{}
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		instructions = append(instructions, current+line)
+		current = ""
+	}
+
+	return instructions
+}
+
+// patterns of a .dockerignore file
+type dockerignore []string
+
+// read the .dockerignore file of the Dockerfile, or else of the build context
+func readDockerignore(dockerfile string, context string) dockerignore {
+	content, err := os.ReadFile(dockerfile + ".dockerignore")
+	if err != nil {
+		content, _ = os.ReadFile(filepath.Join(context, ".dockerignore"))
+	}
+	patterns := dockerignore{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(line, "!")
+		pattern := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(strings.TrimPrefix(line, "!"))), "/")
+		patterns = append(patterns, lo.Ternary(negate, "!", "")+pattern)
+	}
+
+	return patterns
+}
+
+// return whether the path, relative to the build context, is excluded: the
+// last pattern matching it or one of its parent directories wins
+func (patterns dockerignore) excluded(rel string) bool {
+	excluded := false
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		re, err := regexp.Compile(dockerignoreRegexp(strings.TrimPrefix(pattern, "!")))
+		if err != nil {
+			continue
+		}
+		parts := strings.Split(rel, "/")
+		for i := range parts {
+			if re.MatchString(strings.Join(parts[:i+1], "/")) {
+				excluded = !negate
+				break
+			}
+		}
+	}
+
+	return excluded
+}
+
+// return whether whole directories can be skipped, which is not the case if
+// some of their files may be included again
+func (patterns dockerignore) skipsDirectories() bool {
+	return !lo.SomeBy(patterns, func(p string) bool { return strings.HasPrefix(p, "!") })
+}
+
+// convert the .dockerignore pattern to a regular expression: ** matches any
+// number of directories, * and ? do not match separators
+func dockerignoreRegexp(pattern string) string {
+	re := ""
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re += "(.*/)?"
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re += ".*"
+			i++
+		case c == '*':
+			re += "[^/]*"
+		case c == '?':
+			re += "[^/]"
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				re += regexp.QuoteMeta(pattern[i:])
+				i = len(pattern)
+				continue
+			}
+			re += strings.Replace(pattern[i:i+end+1], "[!", "[^", 1)
+			i += end
+		case c == '\\' && i+1 < len(pattern):
+			re += regexp.QuoteMeta(pattern[i+1 : i+2])
+			i++
+		default:
+			re += regexp.QuoteMeta(string(c))
+		}
+	}
+
+	return "^" + re + "$"
+}
+
+// return the build context files referenced by COPY and ADD instructions,
+// without the ones excluded by .dockerignore nor the git directory, which
+// changes with every commit
+func dockerfileSources(dockerfile string, context string) []string {
+	ignore := readDockerignore(dockerfile, context)
+	sources := []string{}
+	for _, instruction := range dockerfileInstructions(dockerfile) {
+		fields := strings.Fields(instruction)
+		if len(fields) < 3 {
+			continue
+		}
+		if keyword := strings.ToUpper(fields[0]); keyword != "COPY" && keyword != "ADD" {
+			continue
+		}
+		args := []string{}
+		fromStage := false
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "--from=") {
+				fromStage = true
+			}
+			if !strings.HasPrefix(field, "--") {
+				args = append(args, field)
+			}
+		}
+		// files copied from another stage or image are not in the context
+		if fromStage || len(args) < 2 {
+			continue
+		}
+		// exec form: COPY ["src", "dest"]
+		if strings.HasPrefix(args[0], "[") {
+			var exec []string
+			if err := json.Unmarshal([]byte(strings.Join(args, " ")), &exec); err != nil {
+				continue
+			}
+			args = exec
+		}
+		if len(args) < 2 {
+			continue
+		}
+		for _, src := range args[:len(args)-1] {
+			if strings.Contains(src, "://") {
+				continue
+			}
+			matches, _ := filepath.Glob(filepath.Join(context, src))
+			for _, match := range matches {
+				filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+					if err != nil {
+						return nil
+					}
+					rel, _ := filepath.Rel(context, path)
+					rel = filepath.ToSlash(rel)
+					switch {
+					case entry.IsDir() && (entry.Name() == ".git" || ignore.skipsDirectories() && ignore.excluded(rel)):
+						return filepath.SkipDir
+					case !entry.IsDir() && !ignore.excluded(rel):
+						sources = append(sources, path)
+					}
+					return nil
+				})
+			}
+		}
+	}
+	sort.Strings(sources)
+
+	return sources
+}
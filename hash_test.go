@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDockerfileSources(t *testing.T) {
+	tests := []struct {
+		name         string
+		dockerfile   string
+		dockerignore string
+		want         []string
+	}{
+		{"single file", "FROM alpine\nCOPY go.mod /src/\n", "", []string{"go.mod"}},
+		{"directory", "FROM alpine\nCOPY src /src\n", "", []string{"src/main.go", "src/util.go"}},
+		{"glob", "FROM alpine\nADD src/*.go /src/\n", "", []string{"src/main.go", "src/util.go"}},
+		{"exec form", "FROM alpine\nCOPY [\"go.mod\", \"go.sum\", \"/src/\"]\n", "", []string{"go.mod", "go.sum"}},
+		{"flags", "FROM alpine\nCOPY --chown=1000 --chmod=644 go.sum /src/\n", "", []string{"go.sum"}},
+		{"other stage", "FROM golang AS build\nFROM alpine\nCOPY --from=build /app /app\n", "", []string{}},
+		{"url", "FROM alpine\nADD https://example.com/file /file\n", "", []string{}},
+		{"git directory", "FROM alpine\nCOPY . /src\n", "", []string{"go.mod", "go.sum", "src/main.go", "src/util.go"}},
+		{"dockerignore", "FROM alpine\nCOPY . /src\n", "go.*\nsrc/util.go\n", []string{"src/main.go"}},
+		{"dockerignore exception", "FROM alpine\nCOPY . /src\n", "src\n!src/main.go\n", []string{"go.mod", "go.sum", "src/main.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := t.TempDir()
+			files := map[string]string{
+				"go.mod":      "module app\n",
+				"go.sum":      "",
+				"src/main.go": "package main\n",
+				"src/util.go": "package main\n",
+				".git/HEAD":   "ref: refs/heads/main\n",
+				"Dockerfile":  tt.dockerfile,
+			}
+			if tt.dockerignore != "" {
+				files[".dockerignore"] = tt.dockerignore
+			}
+			for name, content := range files {
+				path := filepath.Join(context, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := []string{}
+			for _, path := range dockerfileSources(filepath.Join(context, "Dockerfile"), context) {
+				rel, _ := filepath.Rel(context, path)
+				if rel != "Dockerfile" && rel != ".dockerignore" {
+					got = append(got, filepath.ToSlash(rel))
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("dockerfileSources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
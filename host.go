@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// multipliers of the size units used by hostRequirements
+var sizeUnits = map[string]uint64{
+	"":   1,
+	"kb": 1 << 10,
+	"mb": 1 << 20,
+	"gb": 1 << 30,
+	"tb": 1 << 40,
+}
+
+// parse a size like 4gb into bytes
+func parseSize(s string) (uint64, error) {
+	match := regexp.MustCompile(`^(\d+)([kmgt]b)?$`).FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	value, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return value * sizeUnits[match[2]], nil
+}
+
+// format a size in bytes for humans
+func formatSize(size uint64) string {
+	for _, unit := range []string{"tb", "gb", "mb", "kb"} {
+		if size >= sizeUnits[unit] {
+			return strconv.FormatFloat(math.Round(float64(size)*10/float64(sizeUnits[unit]))/10, 'f', -1, 64) + unit
+		}
+	}
+
+	return strconv.FormatUint(size, 10)
+}
+
+// Resources return the cpus and memory limits of the container, 0 if unset
+func (d *DevContainer) Resources() (float64, uint64, error) {
+	cpus := d.Config.GetFloat64("customizations.devc.resources.cpus")
+	if cpus < 0 {
+		return 0, 0, fmt.Errorf("invalid cpus limit %v", cpus)
+	}
+	var memory uint64
+	if d.Config.IsSet("customizations.devc.resources.memory") {
+		var err error
+		if memory, err = parseSize(d.Config.GetString("customizations.devc.resources.memory")); err != nil {
+			return 0, 0, fmt.Errorf("invalid memory limit: %w", err)
+		}
+	}
+
+	return cpus, memory, nil
+}
+
+// return the directory where the engine stores images and containers
+func (d *DevContainer) engineRootDir() (string, error) {
+	format := "{{ .DockerRootDir }}"
+	if filepath.Base(dockerBin) == "podman" {
+		format = "{{ .Store.GraphRoot }}"
+	}
+
+	return d._ExecCmd([]string{dockerBin, "info", "--format", format}, true)
+}
+
+// CheckHostRequirements exit if the host does not meet the hostRequirements
+func (d *DevContainer) CheckHostRequirements() {
+	failures := []string{}
+
+	if d.Config.IsSet("hostRequirements.cpus") {
+		required := d.Config.GetInt("hostRequirements.cpus")
+		if cpus, err := hostCPUs(); err != nil {
+			log.Debug().Err(err).Msg("cannot check cpus requirement")
+		} else if cpus < required {
+			failures = append(failures, fmt.Sprintf("%d cpus required, %d available", required, cpus))
+		}
+	}
+
+	if d.Config.IsSet("hostRequirements.memory") {
+		required, err := parseSize(d.Config.GetString("hostRequirements.memory"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid memory requirement")
+		}
+		if memory, err := hostMemory(); err != nil {
+			log.Debug().Err(err).Msg("cannot check memory requirement")
+		} else if memory < required {
+			failures = append(failures, fmt.Sprintf("%s of memory required, %s available", formatSize(required), formatSize(memory)))
+		}
+	}
+
+	if d.Config.IsSet("hostRequirements.storage") {
+		required, err := parseSize(d.Config.GetString("hostRequirements.storage"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid storage requirement")
+		}
+		root, err := d.engineRootDir()
+		if err == nil && root == "" {
+			err = fmt.Errorf("unknown %s root directory", dockerBin)
+		}
+		var storage uint64
+		if err == nil {
+			storage, err = diskAvailable(root)
+		}
+		if err != nil {
+			log.Debug().Err(err).Msg("cannot check storage requirement")
+		} else if storage < required {
+			failures = append(failures, fmt.Sprintf("%s of storage required, %s available in %s", formatSize(required), formatSize(storage), root))
+		}
+	}
+
+	for _, failure := range failures {
+		log.Error().Msg(failure)
+	}
+	if len(failures) > 0 {
+		log.Fatal().Msg("host does not meet hostRequirements")
+	}
+}
@@ -0,0 +1,73 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// return the number of processors listed in /proc/cpuinfo
+func hostCPUs() (int, error) {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	cpus := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key, _, _ := strings.Cut(scanner.Text(), ":"); strings.TrimSpace(key) == "processor" {
+			cpus++
+		}
+	}
+
+	return cpus, scanner.Err()
+}
+
+// return the total memory from /proc/meminfo, in bytes
+func hostMemory() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			return kb << 10, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.New("MemTotal not found in /proc/meminfo")
+}
+
+// return the space available on the filesystem of the path, in bytes, the
+// path being replaced by its closest existing parent
+func diskAvailable(path string) (uint64, error) {
+	for {
+		var stat syscall.Statfs_t
+		err := syscall.Statfs(path, &stat)
+		if err == nil {
+			return stat.Bavail * uint64(stat.Bsize), nil
+		}
+		if parent := filepath.Dir(path); parent != path && errors.Is(err, os.ErrNotExist) {
+			path = parent
+			continue
+		}
+		return 0, fmt.Errorf("cannot stat %s filesystem: %w", path, err)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+var errHostUnsupported = errors.New("host resources are only checked on linux")
+
+func hostCPUs() (int, error) {
+	return 0, errHostUnsupported
+}
+
+func hostMemory() (uint64, error) {
+	return 0, errHostUnsupported
+}
+
+func diskAvailable(_ string) (uint64, error) {
+	return 0, errHostUnsupported
+}
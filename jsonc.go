@@ -0,0 +1,508 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSONNode is a JSONC value along with its position in the source document
+type JSONNode struct {
+	// Kind is one of object, array, string, number, boolean or null
+	Kind    string
+	Start   int
+	End     int
+	Members []*JSONMember
+	Items   []*JSONNode
+	Value   interface{}
+}
+
+// JSONMember is an object member along with its position in the source
+// document
+type JSONMember struct {
+	Key      string
+	KeyStart int
+	Start    int
+	End      int
+	Value    *JSONNode
+}
+
+// JSONSyntaxError is a JSONC syntax error at the given offset
+type JSONSyntaxError struct {
+	Offset  int
+	Message string
+}
+
+func (e *JSONSyntaxError) Error() string {
+	return e.Message
+}
+
+// parser of JSON with comments and trailing commas, keeping track of the
+// values positions
+type jsoncParser struct {
+	src []byte
+	pos int
+}
+
+// ParseJSONC parse the JSONC document
+func ParseJSONC(src []byte) (*JSONNode, error) {
+	p := &jsoncParser{src: src}
+	node, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q after value", p.src[p.pos])
+	}
+
+	return node, nil
+}
+
+func (p *jsoncParser) errorf(format string, args ...interface{}) error {
+	return &JSONSyntaxError{Offset: p.pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// skip whitespaces and comments
+func (p *jsoncParser) skip() error {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case c == '/' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '/':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '/' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '*':
+			end := strings.Index(string(p.src[p.pos+2:]), "*/")
+			if end < 0 {
+				return p.errorf("unterminated comment")
+			}
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (p *jsoncParser) value() (*JSONNode, error) {
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of document")
+	}
+
+	switch c := p.src[p.pos]; {
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"':
+		start := p.pos
+		s, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		return &JSONNode{Kind: "string", Start: start, End: p.pos, Value: s}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.number()
+	default:
+		for _, literal := range []struct {
+			text  string
+			kind  string
+			value interface{}
+		}{{"true", "boolean", true}, {"false", "boolean", false}, {"null", "null", nil}} {
+			if strings.HasPrefix(string(p.src[p.pos:]), literal.text) {
+				start := p.pos
+				p.pos += len(literal.text)
+				return &JSONNode{Kind: literal.kind, Start: start, End: p.pos, Value: literal.value}, nil
+			}
+		}
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *jsoncParser) object() (*JSONNode, error) {
+	node := &JSONNode{Kind: "object", Start: p.pos}
+	p.pos++
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated object")
+		}
+		// also handles trailing commas
+		if p.src[p.pos] == '}' {
+			p.pos++
+			break
+		}
+		if p.src[p.pos] != '"' {
+			return nil, p.errorf("expected object key, found %q", p.src[p.pos])
+		}
+		member := &JSONMember{KeyStart: p.pos, Start: p.pos}
+		key, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		member.Key = key
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.src) || p.src[p.pos] != ':' {
+			return nil, p.errorf("expected ':' after object key")
+		}
+		p.pos++
+		if member.Value, err = p.value(); err != nil {
+			return nil, err
+		}
+		member.End = member.Value.End
+		node.Members = append(node.Members, member)
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+		} else if p.pos < len(p.src) && p.src[p.pos] != '}' {
+			return nil, p.errorf("expected ',' or '}' after object member")
+		}
+	}
+	node.End = p.pos
+
+	return node, nil
+}
+
+func (p *jsoncParser) array() (*JSONNode, error) {
+	node := &JSONNode{Kind: "array", Start: p.pos}
+	p.pos++
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated array")
+		}
+		// also handles trailing commas
+		if p.src[p.pos] == ']' {
+			p.pos++
+			break
+		}
+		item, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		node.Items = append(node.Items, item)
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+		} else if p.pos < len(p.src) && p.src[p.pos] != ']' {
+			return nil, p.errorf("expected ',' or ']' after array item")
+		}
+	}
+	node.End = p.pos
+
+	return node, nil
+}
+
+func (p *jsoncParser) string() (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+		case '"':
+			p.pos++
+			var s string
+			if err := json.Unmarshal(p.src[start:p.pos], &s); err != nil {
+				return "", &JSONSyntaxError{Offset: start, Message: "invalid string"}
+			}
+			return s, nil
+		case '\n':
+			return "", p.errorf("unterminated string")
+		default:
+			p.pos++
+		}
+	}
+
+	return "", p.errorf("unterminated string")
+}
+
+func (p *jsoncParser) number() (*JSONNode, error) {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte("+-0123456789.eE", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	var n float64
+	if err := json.Unmarshal(p.src[start:p.pos], &n); err != nil {
+		return nil, &JSONSyntaxError{Offset: start, Message: "invalid number"}
+	}
+
+	return &JSONNode{Kind: "number", Start: start, End: p.pos, Value: n}, nil
+}
+
+// Interface return the node as a Go value, like encoding/json would decode it
+func (n *JSONNode) Interface() interface{} {
+	switch n.Kind {
+	case "object":
+		m := map[string]interface{}{}
+		for _, member := range n.Members {
+			m[member.Key] = member.Value.Interface()
+		}
+		return m
+	case "array":
+		a := []interface{}{}
+		for _, item := range n.Items {
+			a = append(a, item.Interface())
+		}
+		return a
+	default:
+		return n.Value
+	}
+}
+
+// Member return the object member with the given key
+func (n *JSONNode) Member(key string) *JSONMember {
+	for _, member := range n.Members {
+		if member.Key == key {
+			return member
+		}
+	}
+
+	return nil
+}
+
+// Find return the node at the given path of keys and indexes, or the deepest
+// existing node
+func (n *JSONNode) Find(path []interface{}) *JSONNode {
+	node := n
+	for _, part := range path {
+		switch part := part.(type) {
+		case string:
+			member := node.Member(part)
+			if node.Kind != "object" || member == nil {
+				return node
+			}
+			node = member.Value
+		case int:
+			if node.Kind != "array" || part >= len(node.Items) {
+				return node
+			}
+			node = node.Items[part]
+		}
+	}
+
+	return node
+}
+
+// return the line and column of the offset in the source document
+func position(src []byte, offset int) (int, int) {
+	line, col := 1, 1
+	for i := 0; i < offset && i < len(src); i++ {
+		if src[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+
+	return line, col
+}
+
+// EDITING
+
+// encode the value as JSON, indenting objects with the given prefix
+func encodeJSON(value interface{}, prefix string, indent string) (string, error) {
+	var buf strings.Builder
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if m, ok := value.(map[string]interface{}); ok && len(m) > 0 {
+		encoder.SetIndent(prefix, indent)
+	}
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// return the leading whitespaces of the line containing the offset
+func lineIndent(src []byte, offset int) string {
+	start := offset
+	for start > 0 && src[start-1] != '\n' {
+		start--
+	}
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+
+	return string(src[start:end])
+}
+
+// return the indentation unit used by the document
+func indentUnit(src []byte) string {
+	for _, line := range strings.Split(string(src), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+
+	return "  "
+}
+
+// return the offset where an element can be inserted after the one ending at
+// the given offset, skipping its comma and its trailing comment, and whether it
+// is followed by a comma
+func insertionPoint(src []byte, end int) (int, bool) {
+	pos := end
+	for pos < len(src) && (src[pos] == ' ' || src[pos] == '\t') {
+		pos++
+	}
+	comma := pos < len(src) && src[pos] == ','
+	if comma {
+		pos++
+	}
+	for pos < len(src) && (src[pos] == ' ' || src[pos] == '\t') {
+		pos++
+	}
+	if pos+1 < len(src) && src[pos] == '/' && src[pos+1] == '/' {
+		for pos < len(src) && src[pos] != '\n' {
+			pos++
+		}
+	}
+	if pos < len(src) && (src[pos] == '\n' || src[pos] == '\r') {
+		return pos, comma
+	}
+
+	return -1, comma
+}
+
+// insert the elements text into the container node (object or array) of the
+// document, keeping its layout
+func insertElement(src []byte, node *JSONNode, last int, text string) []byte {
+	unit := indentUnit(src)
+	out := string(src)
+
+	// empty container
+	if last < 0 {
+		inner := strings.TrimSpace(string(src[node.Start+1 : node.End-1]))
+		if node.Kind == "array" || inner != "" {
+			return []byte(out[:node.Start+1] + text + out[node.Start+1:])
+		}
+		indent := lineIndent(src, node.Start)
+		return []byte(out[:node.Start+1] + "\n" + indent + unit + text + "\n" + indent + out[node.End-1:])
+	}
+
+	point, comma := insertionPoint(src, last)
+	if point < 0 {
+		// single line container, a trailing comma stays after the new element
+		return []byte(out[:last] + ", " + text + out[last:])
+	}
+
+	// multiline container, keep the trailing comma style
+	indent := lineIndent(src, last)
+	element := "\n" + indent + text
+	if comma {
+		return []byte(out[:point] + element + "," + out[point:])
+	}
+
+	return []byte(out[:last] + "," + out[last:point] + element + out[point:])
+}
+
+// SetJSONC set the value at the given path of keys, creating the missing
+// objects, while preserving the comments and layout of the document
+func SetJSONC(src []byte, path []string, value interface{}) ([]byte, error) {
+	root, err := ParseJSONC(src)
+	if err != nil {
+		return nil, err
+	}
+
+	// find the deepest existing object
+	node := root
+	depth := 0
+	for depth < len(path) {
+		if node.Kind != "object" {
+			return nil, fmt.Errorf("%s is not an object", strings.Join(path[:depth], "."))
+		}
+		member := node.Member(path[depth])
+		if member == nil {
+			break
+		}
+		node = member.Value
+		depth++
+	}
+
+	unit := indentUnit(src)
+
+	// replace the existing value
+	if depth == len(path) {
+		text, err := encodeJSON(value, lineIndent(src, node.Start), unit)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(string(src[:node.Start]) + text + string(src[node.End:])), nil
+	}
+
+	// insert a member holding the remaining path
+	for i := len(path) - 1; i > depth; i-- {
+		value = map[string]interface{}{path[i]: value}
+	}
+	indent := lineIndent(src, node.Start) + unit
+	if len(node.Members) > 0 {
+		indent = lineIndent(src, node.Members[0].KeyStart)
+	}
+	key, _ := encodeJSON(path[depth], "", unit)
+	text, err := encodeJSON(value, indent, unit)
+	if err != nil {
+		return nil, err
+	}
+	last := -1
+	if len(node.Members) > 0 {
+		last = node.Members[len(node.Members)-1].End
+	}
+
+	return insertElement(src, node, last, key+": "+text), nil
+}
+
+// AppendJSONC append the value to the array at the given path of keys,
+// creating it if needed, while preserving the comments and layout of the
+// document
+func AppendJSONC(src []byte, path []string, value interface{}) ([]byte, error) {
+	root, err := ParseJSONC(src)
+	if err != nil {
+		return nil, err
+	}
+
+	node := root
+	for _, key := range path {
+		member := node.Member(key)
+		if node.Kind != "object" || member == nil {
+			return SetJSONC(src, path, []interface{}{value})
+		}
+		node = member.Value
+	}
+	if node.Kind != "array" {
+		return nil, fmt.Errorf("%s is not an array", strings.Join(path, "."))
+	}
+
+	text, err := encodeJSON(value, "", indentUnit(src))
+	if err != nil {
+		return nil, err
+	}
+	last := -1
+	if len(node.Items) > 0 {
+		last = node.Items[len(node.Items)-1].End
+	}
+
+	return insertElement(src, node, last, text), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSetJSONC(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		path  []string
+		value interface{}
+		want  string
+	}{
+		{
+			name:  "replace value",
+			src:   "{\n  // base image\n  \"image\": \"alpine\",\n}\n",
+			path:  []string{"image"},
+			value: "node:20",
+			want:  "{\n  // base image\n  \"image\": \"node:20\",\n}\n",
+		},
+		{
+			name:  "add member",
+			src:   "{\n  \"image\": \"alpine\"\n}\n",
+			path:  []string{"remoteUser"},
+			value: "vscode",
+			want:  "{\n  \"image\": \"alpine\",\n  \"remoteUser\": \"vscode\"\n}\n",
+		},
+		{
+			name:  "create objects",
+			src:   "{\n  \"image\": \"alpine\"\n}\n",
+			path:  []string{"customizations", "devc", "forwardSshAgent"},
+			value: true,
+			want:  "{\n  \"image\": \"alpine\",\n  \"customizations\": {\n    \"devc\": {\n      \"forwardSshAgent\": true\n    }\n  }\n}\n",
+		},
+		{
+			name:  "empty object",
+			src:   "{}\n",
+			path:  []string{"image"},
+			value: "alpine",
+			want:  "{\n  \"image\": \"alpine\"\n}\n",
+		},
+		{
+			name:  "tab indentation",
+			src:   "{\n\t\"image\": \"alpine\"\n}\n",
+			path:  []string{"build", "dockerfile"},
+			value: "Dockerfile",
+			want:  "{\n\t\"image\": \"alpine\",\n\t\"build\": {\n\t\t\"dockerfile\": \"Dockerfile\"\n\t}\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SetJSONC([]byte(tt.src), tt.path, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("SetJSONC() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetJSONCNotObject(t *testing.T) {
+	if _, err := SetJSONC([]byte(`{"image": "alpine"}`), []string{"image", "name"}, "node"); err == nil {
+		t.Error("SetJSONC() into a string succeeded")
+	}
+}
+
+func TestAppendJSONC(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		path  []string
+		value interface{}
+		want  string
+	}{
+		{
+			name:  "append item",
+			src:   "{\n  \"forwardPorts\": [\n    3000, // web\n  ]\n}\n",
+			path:  []string{"forwardPorts"},
+			value: 8080,
+			want:  "{\n  \"forwardPorts\": [\n    3000, // web\n    8080,\n  ]\n}\n",
+		},
+		{
+			name:  "inline array",
+			src:   "{\"forwardPorts\": [3000]}\n",
+			path:  []string{"forwardPorts"},
+			value: 8080,
+			want:  "{\"forwardPorts\": [3000, 8080]}\n",
+		},
+		{
+			name:  "create array",
+			src:   "{\n  \"image\": \"alpine\"\n}\n",
+			path:  []string{"forwardPorts"},
+			value: 3000,
+			want:  "{\n  \"image\": \"alpine\",\n  \"forwardPorts\": [3000]\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AppendJSONC([]byte(tt.src), tt.path, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("AppendJSONC() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+// lifecycle steps, in their running order
+var lifecycleSteps = []string{
+	"initializeCommand",
+	"onCreateCommand",
+	"postCreateCommand",
+	"postStartCommand",
+	"postAttachCommand",
+}
+
+// return the short identifier of the current container, which names the
+// directory of its lifecycle step logs
+func (d *DevContainer) containerID() (string, error) {
+	id, err := d.Engine.Inspect("{{ .Id }}")
+	// the container is not created in dry-run mode
+	if rootDryRun && (err != nil || id == "") {
+		return dryRunContainer, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(id) > 12 {
+		id = id[:12]
+	}
+
+	return id, nil
+}
+
+// return the log file of the lifecycle step of the container,
+// initializeCommand running on the host before the container exists
+func (d *DevContainer) stepLogPath(step string, container string) string {
+	if step == "initializeCommand" {
+		return filepath.Join(d.StateDir(), "logs", step+".log")
+	}
+
+	return filepath.Join(d.StateDir(), "logs", container, step+".log")
+}
+
+// run the command of the lifecycle step, on the host for initializeCommand and
+// inside the container otherwise, while writing its output to the step log
+// file and, unless quiet, to the terminal
+func (d *DevContainer) execStep(step string, container string, command []string, quiet bool) error {
+	if step != "initializeCommand" {
+		command = d.Engine.ExecArgs(command, !quiet && isTerminal())
+	}
+
+	var logFile *os.File
+	err := hostChange("", func() error {
+		path := d.stepLogPath(step, container)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(f, "==> %s %s: %s\n", time.Now().Format(time.RFC3339), step, shellJoin(command))
+		logFile = f
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	output := []io.Writer{}
+	if logFile != nil {
+		defer logFile.Close()
+		output = append(output, logFile)
+	}
+	_, err = d._ExecCmd(command, quiet, output...)
+
+	return err
+}
+
+// print the new content of the files as it is written, until interrupted
+func followFiles(paths []string, offsets map[string]int64) {
+	for {
+		for _, path := range paths {
+			f, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			if _, err := f.Seek(offsets[path], io.SeekStart); err == nil {
+				n, _ := io.Copy(os.Stdout, f)
+				offsets[path] += n
+			}
+			f.Close()
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// COMMANDS
+
+func (d *DevContainer) Logs(_ *cobra.Command, _ []string) {
+	if logsContainer {
+		if _, err := d.Engine.Logs(logsFollow); err != nil {
+			log.Fatal().Err(err).Msg("cannot show container logs")
+		}
+		return
+	}
+
+	steps := lifecycleSteps
+	if logsStep != "" {
+		// postCreate is a shorthand of postCreateCommand
+		step := strings.TrimSuffix(logsStep, "Command") + "Command"
+		if !lo.Contains(lifecycleSteps, step) {
+			log.Fatal().Str("step", logsStep).Msgf("step must be one of: %s", strings.Join(lifecycleSteps, ", "))
+		}
+		steps = []string{step}
+	}
+
+	container, containerErr := d.containerID()
+	paths := []string{}
+	offsets := map[string]int64{}
+	for _, step := range steps {
+		if step != "initializeCommand" && containerErr != nil {
+			log.Fatal().Err(containerErr).Msg("cannot find devcontainer")
+		}
+		path := d.stepLogPath(step, container)
+		paths = append(paths, path)
+		content, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			log.Fatal().Err(err).Msg("cannot read logs")
+		}
+		os.Stdout.Write(content)
+		offsets[path] = int64(len(content))
+	}
+	if logsFollow {
+		followFiles(paths, offsets)
+	}
+}
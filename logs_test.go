@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestDryRunStep(t *testing.T) {
+	tests := []struct {
+		name    string
+		step    string
+		command interface{}
+		want    string
+	}{
+		{"string command", "postCreateCommand", "make install", "--workdir /workspace '<container>' sh -c 'make install'"},
+		{"array command", "onCreateCommand", []interface{}{"npm", "ci"}, "--workdir /workspace '<container>' npm ci"},
+	}
+	rootDryRun = true
+	defer func() { rootDryRun = false }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// nothing exists in dry-run mode, and other commands are printed
+			printed := []string{}
+			record := func(command []string, _ bool, _ ...io.Writer) (string, error) {
+				if !isQueryCommand(command) {
+					printed = append(printed, shellJoin(command))
+				}
+				return "", nil
+			}
+			d := DevContainer{
+				Config:               viper.New(),
+				Engine:               &Docker{_ExecCmd: record, WorkDir: "/workspace"},
+				WorkingDirectoryPath: t.TempDir(),
+				_ExecCmd:             record,
+			}
+			d.Config.Set(tt.step, tt.command)
+			d.cmd(tt.step, false)
+			// the tty depends on the terminal running the tests
+			got := strings.Join(printed, "\n")
+			if !strings.HasPrefix(got, "docker container exec ") || !strings.HasSuffix(got, tt.want) {
+				t.Errorf("printed %q, want docker container exec ... %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// canonical names of the --mount options aliases
+var mountAliases = map[string]string{
+	"destination": "target",
+	"dst":         "target",
+	"ro":          "readonly",
+	"src":         "source",
+}
+
+// security options accepted by the engines
+var securityOpts = []string{"apparmor", "label", "mask", "no-new-privileges", "proc-opts", "seccomp", "systempaths", "unmask"}
+
+// parse a --mount string into its options, with canonical names
+func parseMount(mount string) map[string]string {
+	options := map[string]string{}
+	for _, option := range strings.Split(mount, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		if alias, ok := mountAliases[key]; ok {
+			key = alias
+		}
+		options[key] = value
+	}
+
+	return options
+}
+
+// normalizeMount convert a mount, either a --mount string or an object, to a
+// --mount string after checking it
+func normalizeMount(mount interface{}) (string, error) {
+	var s string
+	switch mount := mount.(type) {
+	case string:
+		s = mount
+	case map[string]interface{}:
+		if _, ok := mount["type"]; !ok {
+			return "", fmt.Errorf("mount %v has no type", mount)
+		}
+		// type first, then the other options in a stable order
+		keys := lo.Without(lo.Keys(mount), "type")
+		sort.Strings(keys)
+		options := []string{"type=" + fmt.Sprint(mount["type"])}
+		for _, key := range keys {
+			options = append(options, key+"="+fmt.Sprint(mount[key]))
+		}
+		s = strings.Join(options, ",")
+	default:
+		return "", fmt.Errorf("mount must be a string or an object, found %v", mount)
+	}
+
+	options := parseMount(s)
+	switch {
+	case options["target"] == "":
+		return "", fmt.Errorf("mount %q has no target", s)
+	case !lo.Contains([]string{"", "bind", "volume", "tmpfs"}, options["type"]):
+		return "", fmt.Errorf("mount %q has an unknown type %q", s, options["type"])
+	case options["type"] == "bind" && options["source"] == "":
+		return "", fmt.Errorf("bind mount %q has no source", s)
+	}
+
+	return s, nil
+}
+
+// checkSecurityOpt return an error if the security option is unknown
+func checkSecurityOpt(opt string) error {
+	name := opt
+	if i := strings.IndexAny(opt, "=:"); i >= 0 {
+		name = opt[:i]
+	}
+	if !lo.Contains(securityOpts, name) {
+		return errors.New("unknown security option " + opt)
+	}
+
+	return nil
+}
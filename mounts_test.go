@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeMount(t *testing.T) {
+	tests := []struct {
+		name    string
+		mount   interface{}
+		want    string
+		wantErr bool
+	}{
+		{"string", "type=volume,source=cache,target=/cache", "type=volume,source=cache,target=/cache", false},
+		{"aliases", "type=bind,src=/tmp,dst=/host,ro", "type=bind,src=/tmp,dst=/host,ro", false},
+		{"object", map[string]interface{}{"target": "/cache", "source": "cache", "type": "volume"}, "type=volume,source=cache,target=/cache", false},
+		{"tmpfs", map[string]interface{}{"type": "tmpfs", "target": "/tmp"}, "type=tmpfs,target=/tmp", false},
+		{"object without type", map[string]interface{}{"source": "cache", "target": "/cache"}, "", true},
+		{"no target", "type=volume,source=cache", "", true},
+		{"unknown type", "type=nfs,source=cache,target=/cache", "", true},
+		{"bind without source", "type=bind,target=/host", "", true},
+		{"other value", 42, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeMount(tt.mount)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeMount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeMount() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
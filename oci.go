@@ -0,0 +1,445 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// media type of the OCI image manifests
+const ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+// media types of the image manifests and of the multi-platform indexes, as
+// pushed by docker
+var ociImageMediaTypes = []string{
+	ociManifestMediaType,
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}
+
+// OCIRef is a reference to an artifact of an OCI registry
+type OCIRef struct {
+	Registry   string
+	Repository string
+	Reference  string
+}
+
+// timeout of the registry requests
+const ociTimeout = time.Minute
+
+// OCIRegistry is a minimal client of the OCI distribution API
+type OCIRegistry struct {
+	client   *http.Client
+	token    string
+	basic    bool
+	username string
+	password string
+}
+
+// docker client configuration, holding the registry credentials
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+	Manifests     []struct {
+		ociDescriptor
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+type ociImageConfig struct {
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// ParseOCIRef parse a reference like ghcr.io/owner/repository:tag
+func ParseOCIRef(ref string) (OCIRef, error) {
+	r := OCIRef{Reference: "latest"}
+	registry, repository, found := strings.Cut(ref, "/")
+	if !found || !strings.ContainsAny(registry, ".:") && registry != "localhost" {
+		return r, fmt.Errorf("invalid OCI reference %q, registry is missing", ref)
+	}
+	r.Registry = registry
+	if name, digest, found := strings.Cut(repository, "@"); found {
+		repository, r.Reference = name, digest
+	} else if i := strings.LastIndex(repository, ":"); i > 0 {
+		repository, r.Reference = repository[:i], repository[i+1:]
+	}
+	if repository == "" {
+		return r, fmt.Errorf("invalid OCI reference %q, repository is missing", ref)
+	}
+	r.Repository = repository
+
+	return r, nil
+}
+
+func (r OCIRef) String() string {
+	if strings.HasPrefix(r.Reference, "sha256:") {
+		return r.Registry + "/" + r.Repository + "@" + r.Reference
+	}
+
+	return r.Registry + "/" + r.Repository + ":" + r.Reference
+}
+
+// return the URL of the API path, local registries being served over HTTP
+func (r OCIRef) url(path string) string {
+	scheme := "https"
+	host, _, _ := strings.Cut(r.Registry, ":")
+	if host == "localhost" || host == "127.0.0.1" {
+		scheme = "http"
+	}
+
+	return scheme + "://" + r.Registry + "/v2/" + r.Repository + "/" + path
+}
+
+// NewOCIRegistry return a registry client
+func NewOCIRegistry() *OCIRegistry {
+	return &OCIRegistry{client: &http.Client{Timeout: ociTimeout}}
+}
+
+// return the path of the docker client configuration
+func dockerConfigPath() string {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".docker")
+	}
+
+	return filepath.Join(dir, "config.json")
+}
+
+// return the credentials of the registry saved by docker login, either in
+// the docker configuration or in a credential helper
+func registryCredentials(registry string) (string, string) {
+	content, err := os.ReadFile(dockerConfigPath())
+	if err != nil {
+		return "", ""
+	}
+	config := dockerConfig{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		log.Debug().Err(err).Msg("cannot parse docker configuration")
+		return "", ""
+	}
+
+	helper := config.CredsStore
+	if h, ok := config.CredHelpers[registry]; ok {
+		helper = h
+	}
+	if helper != "" {
+		cmd := exec.Command("docker-credential-"+helper, "get")
+		cmd.Stdin = strings.NewReader(registry)
+		out, err := cmd.Output()
+		credentials := struct {
+			Username string
+			Secret   string
+		}{}
+		if err == nil && json.Unmarshal(out, &credentials) == nil {
+			return credentials.Username, credentials.Secret
+		}
+		log.Debug().Err(err).Str("registry", registry).Msg("no credentials from docker credential helper")
+	}
+
+	for key, auth := range config.Auths {
+		// keys may be URLs
+		host := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+		if host, _, _ = strings.Cut(host, "/"); host != registry {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			continue
+		}
+		username, password, _ := strings.Cut(string(decoded), ":")
+		return username, password
+	}
+
+	return "", ""
+}
+
+// set the authorization header of the request, once authenticated
+func (o *OCIRegistry) authorize(req *http.Request) {
+	if o.token != "" {
+		req.Header.Set("Authorization", "Bearer "+o.token)
+	} else if o.basic {
+		req.SetBasicAuth(o.username, o.password)
+	}
+}
+
+// send the request, authenticating if required, with the docker credentials
+// of the registry or anonymously
+func (o *OCIRegistry) do(req *http.Request) (*http.Response, error) {
+	o.authorize(req)
+	resp, err := o.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || o.token != "" || o.basic {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	if err := o.authenticate(req.URL.Host, resp.Header.Get("WWW-Authenticate")); err != nil {
+		return nil, err
+	}
+	if req.GetBody != nil {
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	o.authorize(req)
+
+	return o.client.Do(req)
+}
+
+// authenticate to the registry as asked by the challenge: with the
+// credentials for a Basic one, or get a token from the realm of a Bearer one
+func (o *OCIRegistry) authenticate(registry string, challenge string) error {
+	o.username, o.password = registryCredentials(registry)
+	if strings.HasPrefix(challenge, "Basic ") {
+		if o.username == "" {
+			return fmt.Errorf("no credentials for registry %s, see docker login", registry)
+		}
+		o.basic = true
+		return nil
+	}
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return fmt.Errorf("unsupported registry authentication %q", challenge)
+	}
+	params := map[string]string{}
+	for _, match := range regexp.MustCompile(`(\w+)="([^"]*)"`).FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+
+	var req *http.Request
+	var err error
+	if o.username == "<token>" {
+		// identity tokens are exchanged for an access token
+		form := url.Values{}
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", o.password)
+		form.Set("client_id", "devc")
+		for _, key := range []string{"service", "scope"} {
+			if params[key] != "" {
+				form.Set(key, params[key])
+			}
+		}
+		req, err = http.NewRequest(http.MethodPost, params["realm"], strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req, err = http.NewRequest(http.MethodGet, params["realm"], nil)
+		if err != nil {
+			return err
+		}
+		query := req.URL.Query()
+		for _, key := range []string{"service", "scope"} {
+			if params[key] != "" {
+				query.Set(key, params[key])
+			}
+		}
+		req.URL.RawQuery = query.Encode()
+		if o.username != "" {
+			req.SetBasicAuth(o.username, o.password)
+		}
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot authenticate to registry: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	o.token = token.Token
+	if o.token == "" {
+		o.token = token.AccessToken
+	}
+
+	return nil
+}
+
+// get the API path, failing on unexpected status
+func (o *OCIRegistry) get(ref OCIRef, path string, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, ref.url(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := o.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("cannot get %s from %s: %s", path, ref, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// Manifest return the image manifest of the reference, or the index for
+// multi-platform images when accepted
+func (o *OCIRegistry) Manifest(ref OCIRef, accept ...string) (*ociManifest, error) {
+	if len(accept) == 0 {
+		accept = []string{ociManifestMediaType}
+	}
+	resp, err := o.get(ref, "manifests/"+ref.Reference, strings.Join(accept, ", "))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	manifest := &ociManifest{}
+	if err := json.NewDecoder(resp.Body).Decode(manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Blob return the content of the blob, to be closed by the caller
+func (o *OCIRegistry) Blob(ref OCIRef, digest string) (io.ReadCloser, error) {
+	resp, err := o.get(ref, "blobs/"+digest, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// ImageLabels return the labels of the image, for the current platform if it
+// is a multi-platform one
+func (o *OCIRegistry) ImageLabels(ref OCIRef) (map[string]string, error) {
+	manifest, err := o.Manifest(ref, ociImageMediaTypes...)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Manifests) > 0 {
+		digest := manifest.Manifests[0].Digest
+		for _, m := range manifest.Manifests {
+			if m.Platform.OS == runtime.GOOS && m.Platform.Architecture == runtime.GOARCH {
+				digest = m.Digest
+				break
+			}
+		}
+		platformRef := ref
+		platformRef.Reference = digest
+		if manifest, err = o.Manifest(platformRef, ociImageMediaTypes...); err != nil {
+			return nil, err
+		}
+	}
+
+	blob, err := o.Blob(ref, manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	config := ociImageConfig{}
+	if err := json.NewDecoder(blob).Decode(&config); err != nil {
+		return nil, err
+	}
+
+	return config.Config.Labels, nil
+}
+
+// Pull extract the tar layers of the artifact into the directory
+func (o *OCIRegistry) Pull(ref OCIRef, dir string) error {
+	manifest, err := o.Manifest(ref)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Layers) == 0 {
+		return fmt.Errorf("%s has no layers", ref)
+	}
+	for _, layer := range manifest.Layers {
+		blob, err := o.Blob(ref, layer.Digest)
+		if err != nil {
+			return err
+		}
+		err = untar(blob, dir)
+		blob.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extract the tar stream into the directory
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, header.Name)
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+			continue
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
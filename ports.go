@@ -0,0 +1,697 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+// format returning the IP addresses of a container
+const containerIPFormat = `{{ range .NetworkSettings.Networks }}{{ .IPAddress }} {{ end }}`
+
+// shell script connecting stdin/stdout to the given host and port from inside
+// the container, without requiring socat
+const execDialScript = `if command -v nc >/dev/null 2>&1; then exec nc "$0" "$1"; fi
+exec bash -c 'exec 3<>"/dev/tcp/$0/$1"; cat <&3 & cat >&3' "$0" "$1"`
+
+// PortAttributes holds the settings of portsAttributes and otherPortsAttributes
+type PortAttributes struct {
+	Label            string
+	OnAutoForward    string
+	Protocol         string
+	RequireLocalPort bool
+}
+
+// PortForward describe a port forwarded from the host to the container
+type PortForward struct {
+	Host      string `json:"host,omitempty"`
+	Port      int    `json:"port"`
+	LocalPort int    `json:"localPort"`
+	Label     string `json:"label,omitempty"`
+	Source    string `json:"source"`
+}
+
+// ForwarderState is the state shared by the forwarder process with other devc
+// commands
+type ForwarderState struct {
+	Pid         int           `json:"pid"`
+	Forwards    []PortForward `json:"forwards"`
+	SSHAuthSock string        `json:"sshAuthSock,omitempty"`
+}
+
+// Forwarder proxies host ports to the devcontainer
+type Forwarder struct {
+	devc          *DevContainer
+	ips           map[string]string
+	ipUnreachable atomic.Bool
+	listeners     map[string]net.Listener
+	mu            sync.Mutex
+	state         ForwarderState
+}
+
+// parse a forwardPorts entry: a port number or a "host:port" string
+func parsePort(entry string) (string, int, error) {
+	host := ""
+	if i := strings.LastIndex(entry, ":"); i >= 0 {
+		host, entry = entry[:i], entry[i+1:]
+	}
+	port, err := strconv.Atoi(entry)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port: %s", entry)
+	}
+
+	return host, port, nil
+}
+
+// PortAttributes return the attributes matching the given port: the exact
+// port first, then the first port range in sorted order
+func (d *DevContainer) PortAttributes(host string, port int) PortAttributes {
+	key := "otherPortsAttributes"
+	attributes := d.Config.GetStringMap("portsAttributes")
+	if _, ok := attributes[strconv.Itoa(port)]; ok {
+		key = "portsAttributes." + strconv.Itoa(port)
+	} else if _, ok := attributes[host+":"+strconv.Itoa(port)]; ok && host != "" {
+		key = "portsAttributes." + host + ":" + strconv.Itoa(port)
+	} else {
+		ranges := lo.Keys(attributes)
+		sort.Strings(ranges)
+		for _, k := range ranges {
+			// port range: "3000-3010"
+			if start, end, found := strings.Cut(k, "-"); found {
+				from, errFrom := strconv.Atoi(start)
+				to, errTo := strconv.Atoi(end)
+				if errFrom == nil && errTo == nil && port >= from && port <= to {
+					key = "portsAttributes." + k
+					break
+				}
+			}
+		}
+	}
+
+	return PortAttributes{
+		Label:            d.Config.GetString(key + ".label"),
+		OnAutoForward:    d.Config.GetString(key + ".onAutoForward"),
+		Protocol:         d.Config.GetString(key + ".protocol"),
+		RequireLocalPort: d.Config.GetBool(key + ".requireLocalPort"),
+	}
+}
+
+// path of the forwarder state file
+func (d *DevContainer) forwarderStatePath() string {
+	return filepath.Join(d.StateDir(), "forwards.json")
+}
+
+// ForwarderState return the state of the running forwarder process, if any
+func (d *DevContainer) ForwarderState() (ForwarderState, bool) {
+	var state ForwarderState
+	data, err := os.ReadFile(d.forwarderStatePath())
+	if err != nil {
+		return state, false
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, false
+	}
+
+	return state, processAlive(state.Pid)
+}
+
+// return true if a process with the given pid is running
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// return the container ports published by the engine
+func (d *DevContainer) publishedPorts() []int {
+	out, err := d.Engine.Inspect("{{ json .NetworkSettings.Ports }}")
+	if err != nil {
+		return nil
+	}
+	ports := map[string][]struct{ HostPort string }{}
+	if err := json.Unmarshal([]byte(out), &ports); err != nil {
+		return nil
+	}
+	published := []int{}
+	for key, bindings := range ports {
+		// "3000/tcp"
+		port, err := strconv.Atoi(strings.Split(key, "/")[0])
+		if err == nil && len(bindings) > 0 {
+			published = append(published, port)
+		}
+	}
+
+	return published
+}
+
+// return the forwardPorts entries which are not published by the engine, like
+// those of compose services or added after the container creation
+func (d *DevContainer) forwardedPorts() []string {
+	entries := d.Config.GetStringSlice("forwardPorts")
+	if len(entries) == 0 {
+		return nil
+	}
+	published := d.publishedPorts()
+
+	return lo.Filter(entries, func(entry string, _ int) bool {
+		host, port, err := parsePort(entry)
+		return err != nil || host != "" || !lo.Contains(published, port)
+	})
+}
+
+// NeedsForwarder return true if something must be forwarded to the container
+func (d *DevContainer) NeedsForwarder() bool {
+	return len(d.forwardedPorts()) > 0 ||
+		d.Config.GetBool("customizations.devc.autoForwardPorts") ||
+		d.ForwardsAgents() ||
+		d.Config.GetBool("customizations.devc.copyGitConfig")
+}
+
+// StartForwarder start the forwarder process in background if needed
+func (d *DevContainer) StartForwarder() {
+	if !d.NeedsForwarder() {
+		return
+	}
+	// concurrent devc commands must not start several forwarders
+	if !rootDryRun {
+		lock, err := lockFile(filepath.Join(d.StateDir(), "forward.lock"))
+		if err != nil {
+			log.Error().Err(err).Msg("cannot start forwarder")
+			return
+		}
+		defer lock.Close()
+	}
+	if state, alive := d.ForwarderState(); alive {
+		// the ssh agent socket changes between logins
+		if !d.Config.GetBool("customizations.devc.forwardSshAgent") || state.SSHAuthSock == os.Getenv("SSH_AUTH_SOCK") {
+			return
+		}
+		d.StopForwarder()
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		log.Error().Err(err).Msg("cannot start forwarder")
+		return
+	}
+	cmdArgs := []string{"forward", "--config-dir", rootConfigDir}
+	cmdArgs = append(cmdArgs, "--log-format", rootLogFormat)
+	if d.Instance != "" {
+		cmdArgs = append(cmdArgs, "--instance", d.Instance)
+	}
+	if rootVerbose > 0 {
+		cmdArgs = append(cmdArgs, "-"+strings.Repeat("v", rootVerbose))
+	}
+	start := func() error {
+		if err := os.MkdirAll(d.StateDir(), 0755); err != nil {
+			return err
+		}
+		logFile, err := os.Create(filepath.Join(d.StateDir(), "forward.log"))
+		if err != nil {
+			return err
+		}
+		defer logFile.Close()
+
+		cmd := exec.Command(exe, cmdArgs...)
+		cmd.Dir = d.WorkingDirectoryPath
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+		log.Info().Str("command", cmd.String()).Msg("starting forwarder")
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		exited := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(exited)
+		}()
+
+		// wait for the forwarder to save its state before releasing the lock
+		for i := 0; i < 50; i++ {
+			if state, alive := d.ForwarderState(); alive && state.Pid == cmd.Process.Pid {
+				return nil
+			}
+			select {
+			case <-exited:
+				return fmt.Errorf("forwarder exited, see %s", logFile.Name())
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+
+		return nil
+	}
+	if err := hostChange(shellJoin(append([]string{exe}, cmdArgs...))+" &", start); err != nil {
+		log.Error().Err(err).Msg("cannot start forwarder")
+	}
+}
+
+// open the given lock file and wait for an exclusive lock on it, released by
+// closing the file
+func lockFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// StopForwarder stop the forwarder process if it is running
+func (d *DevContainer) StopForwarder() {
+	state, alive := d.ForwarderState()
+	if !alive {
+		return
+	}
+	hostChange(shellJoin([]string{"kill", strconv.Itoa(state.Pid)}), func() error {
+		if process, err := os.FindProcess(state.Pid); err == nil {
+			log.Info().Int("pid", state.Pid).Msg("stopping forwarder")
+			process.Kill()
+		}
+
+		return os.Remove(d.forwarderStatePath())
+	})
+}
+
+// NewForwarder return a forwarder for the given devcontainer
+func NewForwarder(d *DevContainer) *Forwarder {
+	return &Forwarder{
+		devc:      d,
+		ips:       map[string]string{},
+		listeners: map[string]net.Listener{},
+		state:     ForwarderState{Pid: os.Getpid(), Forwards: []PortForward{}},
+	}
+}
+
+// save write the forwarder state for other devc commands
+func (f *Forwarder) save() {
+	if err := writeJSON(f.devc.forwarderStatePath(), f.state); err != nil {
+		log.Error().Err(err).Msg("cannot save forwarder state")
+	}
+}
+
+// Add listen on a local port and proxy its connections to the container
+func (f *Forwarder) Add(host string, port int, source string) error {
+	attributes := f.devc.PortAttributes(host, port)
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		if attributes.RequireLocalPort {
+			return err
+		}
+		// fallback to a random local port
+		if listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			return err
+		}
+	}
+
+	forward := PortForward{
+		Host:      host,
+		Port:      port,
+		LocalPort: listener.Addr().(*net.TCPAddr).Port,
+		Label:     attributes.Label,
+		Source:    source,
+	}
+	f.mu.Lock()
+	f.state.Forwards = append(f.state.Forwards, forward)
+	f.listeners[net.JoinHostPort(host, strconv.Itoa(port))] = listener
+	f.save()
+	f.mu.Unlock()
+	log.Info().Str("host", host).Int("port", port).Int("local_port", forward.LocalPort).Msg("port forwarded")
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			} else if err != nil {
+				log.Error().Err(err).Int("port", port).Msg("cannot accept connection")
+				return
+			}
+			go f.proxy(conn, host, port)
+		}
+	}()
+
+	return nil
+}
+
+// Remove stop forwarding the given port
+func (f *Forwarder) Remove(host string, port int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := net.JoinHostPort(host, strconv.Itoa(port))
+	if listener, ok := f.listeners[key]; ok {
+		listener.Close()
+		delete(f.listeners, key)
+	}
+	f.state.Forwards = lo.Reject(f.state.Forwards, func(forward PortForward, _ int) bool {
+		return forward.Host == host && forward.Port == port
+	})
+	f.save()
+	log.Info().Str("host", host).Int("port", port).Msg("port no longer forwarded")
+}
+
+// return the ports forwarded automatically
+func (f *Forwarder) autoForwarded() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return lo.FilterMap(f.state.Forwards, func(forward PortForward, _ int) (int, bool) {
+		return forward.Port, forward.Source == "auto"
+	})
+}
+
+// Forwarded return true if the given port is already forwarded
+func (f *Forwarder) Forwarded(host string, port int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, forward := range f.state.Forwards {
+		if forward.Host == host && forward.Port == port {
+			return true
+		}
+	}
+
+	return false
+}
+
+// proxy the connection to the given port of the container
+func (f *Forwarder) proxy(conn net.Conn, host string, port int) {
+	remote, err := f.dial(host, port)
+	if err != nil {
+		log.Error().Err(err).Int("port", port).Msg("cannot connect to container")
+		conn.Close()
+		return
+	}
+	pipe(conn, remote)
+}
+
+// ListeningPorts return the TCP ports listening inside the container
+func ListeningPorts(e Engine) ([]int, error) {
+	// polled every few seconds, so the command is not logged
+	cmdArgs := e.ExecArgs([]string{"sh", "-c", "cat /proc/net/tcp /proc/net/tcp6 2>/dev/null"}, false)
+	stdout, err := exec.Command(cmdArgs[0], cmdArgs[1:]...).Output()
+	out := string(stdout)
+	if err != nil && out == "" {
+		return nil, err
+	}
+
+	ports := []int{}
+	for _, line := range strings.Split(out, "\n") {
+		// sl local_address rem_address st ...
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[3] != "0A" {
+			continue
+		}
+		_, hexPort, found := strings.Cut(fields[1], ":")
+		if !found {
+			continue
+		}
+		port, err := strconv.ParseInt(hexPort, 16, 32)
+		if err != nil {
+			continue
+		}
+		if !lo.Contains(ports, int(port)) {
+			ports = append(ports, int(port))
+		}
+	}
+	sort.Ints(ports)
+
+	return ports, nil
+}
+
+// Watch poll the ports listening inside the container, forward the new ones
+// according to their onAutoForward attribute and stop forwarding the closed
+// ones, only logging the changes
+func (f *Forwarder) Watch(interval time.Duration) {
+	ignored := map[int]bool{}
+	// published ports are already reachable
+	published := f.devc.publishedPorts()
+	lastErr := ""
+	for {
+		ports, err := ListeningPorts(f.devc.Engine)
+		if err != nil {
+			if err.Error() != lastErr {
+				log.Debug().Err(err).Msg("cannot list listening ports")
+				lastErr = err.Error()
+			}
+			time.Sleep(interval)
+			continue
+		}
+		lastErr = ""
+		for port := range ignored {
+			if !lo.Contains(ports, port) {
+				delete(ignored, port)
+			}
+		}
+		for _, port := range f.autoForwarded() {
+			if !lo.Contains(ports, port) {
+				f.Remove("", port)
+			}
+		}
+		for _, port := range ports {
+			if ignored[port] || lo.Contains(published, port) || f.Forwarded("", port) {
+				continue
+			}
+			attributes := f.devc.PortAttributes("", port)
+			if attributes.OnAutoForward == "ignore" {
+				ignored[port] = true
+				continue
+			}
+			if err := f.Add("", port, "auto"); err != nil {
+				log.Error().Err(err).Int("port", port).Msg("cannot forward port")
+				ignored[port] = true
+				continue
+			}
+			if attributes.OnAutoForward != "silent" {
+				log.Warn().Int("port", port).Str("label", attributes.Label).Msg("new listening port detected and forwarded")
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// return the IP address of the container running the given host
+func (f *Forwarder) containerIP(host string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ip, ok := f.ips[host]; ok {
+		return ip, nil
+	}
+
+	var out string
+	var err error
+	switch compose, isCompose := f.devc.Engine.(*DockerCompose); {
+	case host == "" || host == "localhost" || host == "127.0.0.1":
+		out, err = f.devc.Engine.Inspect(containerIPFormat)
+	case isCompose:
+		out, err = compose.InspectService(host, containerIPFormat)
+	default:
+		// not a container, it can only be reached from inside the devcontainer
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	ip := ""
+	if fields := strings.Fields(out); len(fields) > 0 {
+		ip = fields[0]
+	}
+	f.ips[host] = ip
+
+	return ip, nil
+}
+
+// connect to the given port of the container, through its IP address when it
+// is reachable, otherwise through an exec session
+func (f *Forwarder) dial(host string, port int) (io.ReadWriteCloser, error) {
+	if !f.ipUnreachable.Load() {
+		ip, err := f.containerIP(host)
+		if err == nil && ip != "" {
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), 2*time.Second)
+			if err == nil {
+				return conn, nil
+			}
+			// container network is not reachable from the host (e.g. docker
+			// running inside a virtual machine)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				f.ipUnreachable.Store(true)
+			}
+			log.Debug().Err(err).Str("ip", ip).Msg("cannot connect through container ip")
+		}
+	}
+
+	target := host
+	if target == "" || target == "localhost" {
+		target = "127.0.0.1"
+	}
+
+	return execDial(f.devc.Engine, target, port)
+}
+
+// execConn is a connection through the stdin/stdout of an exec session
+type execConn struct {
+	io.Reader
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (c *execConn) Close() error {
+	c.WriteCloser.Close()
+	c.cmd.Process.Kill()
+
+	return c.cmd.Wait()
+}
+
+// connect to the given host and port from inside the container
+func execDial(e Engine, host string, port int) (io.ReadWriteCloser, error) {
+	cmdArgs := e.ExecArgs([]string{"sh", "-c", execDialScript, host, strconv.Itoa(port)}, false)
+	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &execConn{Reader: stdout, WriteCloser: stdin, cmd: cmd}, nil
+}
+
+// copy data both ways until one side is closed
+func pipe(a io.ReadWriteCloser, b io.ReadWriteCloser) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+	a.Close()
+	b.Close()
+}
+
+// COMMANDS
+
+func (d *DevContainer) Forward(_ *cobra.Command, _ []string) {
+	if running, _ := d.Engine.IsRunning(); !running {
+		log.Fatal().Msg("devcontainer is not running")
+	}
+	if _, alive := d.ForwarderState(); alive {
+		log.Fatal().Msg("forwarder is already running")
+	}
+
+	f := NewForwarder(d)
+	f.ForwardAgents()
+	for _, entry := range d.forwardedPorts() {
+		host, port, err := parsePort(entry)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot forward port")
+			continue
+		}
+		if err := f.Add(host, port, "forwardPorts"); err != nil {
+			log.Error().Err(err).Int("port", port).Msg("cannot forward port")
+		}
+	}
+
+	if d.Config.GetBool("customizations.devc.autoForwardPorts") {
+		go f.Watch(2 * time.Second)
+	}
+	if d.Config.GetBool("customizations.devc.copyGitConfig") {
+		if err := f.ServeGitCredentials(); err != nil {
+			log.Error().Err(err).Msg("cannot forward git credentials")
+		}
+	}
+
+	// stop forwarding when the container stops
+	for {
+		time.Sleep(5 * time.Second)
+		if running, err := d.Engine.IsRunning(); err == nil && !running {
+			break
+		}
+	}
+	os.Remove(d.forwarderStatePath())
+}
+
+func (d *DevContainer) Ports(_ *cobra.Command, _ []string) {
+	state, alive := d.ForwarderState()
+	if !alive {
+		state.Forwards = nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PORT\tLOCAL ADDRESS\tLABEL\tSOURCE")
+	for _, forward := range state.Forwards {
+		port := strconv.Itoa(forward.Port)
+		if forward.Host != "" {
+			port = forward.Host + ":" + port
+		}
+		fmt.Fprintf(w, "%s\t127.0.0.1:%d\t%s\t%s\n", port, forward.LocalPort, forward.Label, forward.Source)
+	}
+	w.Flush()
+}
+
+func (d *DevContainer) PortsAdd(_ *cobra.Command, args []string) {
+	host, port, err := parsePort(args[0])
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot add port")
+	}
+	// plain ports are numbers, others are "host:port" strings
+	var value interface{} = port
+	if host != "" {
+		value = host + ":" + strconv.Itoa(port)
+	}
+
+	path := filepath.Join(rootConfigDir, "devcontainer.json")
+	src, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot read devcontainer settings")
+	}
+	root, err := ParseJSONC(src)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot parse devcontainer settings")
+	}
+	if member := root.Member("forwardPorts"); member != nil {
+		for _, item := range member.Value.Items {
+			if fmt.Sprint(item.Value) == fmt.Sprint(value) {
+				log.Info().Str("port", args[0]).Msg("port already forwarded")
+				return
+			}
+		}
+	}
+	out, err := AppendJSONC(src, []string{"forwardPorts"}, value)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot add port")
+	}
+	writeConfig(path, out)
+}
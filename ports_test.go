@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestPortAttributes(t *testing.T) {
+	attributes := map[string]interface{}{
+		"3000":           map[string]interface{}{"label": "exact"},
+		"localhost:3000": map[string]interface{}{"label": "host"},
+		"db:5432":        map[string]interface{}{"label": "db", "onAutoForward": "silent"},
+		"8000-8100":      map[string]interface{}{"label": "first range"},
+		"8050-8200":      map[string]interface{}{"label": "second range", "requireLocalPort": true},
+	}
+	tests := []struct {
+		name string
+		host string
+		port int
+		want PortAttributes
+	}{
+		{"exact port first", "localhost", 3000, PortAttributes{Label: "exact"}},
+		{"host and port", "db", 5432, PortAttributes{Label: "db", OnAutoForward: "silent"}},
+		{"other host", "cache", 5432, PortAttributes{Label: "other", Protocol: "http"}},
+		{"range", "", 8010, PortAttributes{Label: "first range"}},
+		{"sorted ranges", "", 8060, PortAttributes{Label: "first range"}},
+		{"last range", "", 8150, PortAttributes{Label: "second range", RequireLocalPort: true}},
+		{"other port", "", 9000, PortAttributes{Label: "other", Protocol: "http"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DevContainer{Config: viper.New()}
+			d.Config.Set("portsAttributes", attributes)
+			d.Config.Set("otherPortsAttributes", map[string]interface{}{"label": "other", "protocol": "http"})
+			if got := d.PortAttributes(tt.host, tt.port); got != tt.want {
+				t.Errorf("PortAttributes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+// label storing the devcontainer configuration into the images, cf.
+// https://containers.dev/implementors/reference/#labels
+const metadataLabel = "devcontainer.metadata"
+
+// settings stored into the image metadata, cf.
+// https://containers.dev/implementors/spec/#merge-logic
+var metadataProperties = []string{
+	"capAdd", "containerEnv", "containerUser", "customizations", "forwardPorts",
+	"hostRequirements", "init", "mounts", "onCreateCommand", "otherPortsAttributes",
+	"overrideCommand", "portsAttributes", "postAttachCommand", "postCreateCommand",
+	"postStartCommand", "privileged", "remoteEnv", "remoteUser", "securityOpt",
+	"shutdownAction", "updateContentCommand", "updateRemoteUserUID", "userEnvProbe",
+	"waitFor",
+}
+
+// delay before looking up again the metadata of an image which could not be
+// read from its registry, unless the docker credentials changed
+const imageMetadataRetry = time.Hour
+
+// metadata of an image, cached with the identifier of the local image, empty
+// if it has not been pulled, and the error of a failed registry lookup
+type imageMetadataCache struct {
+	ID       string                   `json:"id"`
+	Metadata []map[string]interface{} `json:"metadata"`
+	Error    string                   `json:"error,omitempty"`
+	Time     time.Time                `json:"time"`
+}
+
+// return the metadata entries of the image, from the cache if the image has
+// not changed since they were read, so that the registry is not looked up on
+// every command, and only when asked to
+func (d *DevContainer) imageMetadata(image string, lookup bool) ([]map[string]interface{}, error) {
+	id, err := d._ExecCmd([]string{dockerBin, "image", "ls", "--quiet", image}, true)
+	if err != nil {
+		return nil, err
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	path := filepath.Join(cacheDir, "devc", "images", md5sum(image)+".json")
+	cache := imageMetadataCache{}
+	if content, err := os.ReadFile(path); err == nil && json.Unmarshal(content, &cache) == nil && cache.ID == id {
+		if cache.Error == "" {
+			return cache.Metadata, nil
+		}
+		// unless the credentials changed
+		info, err := os.Stat(dockerConfigPath())
+		loggedIn := err == nil && info.ModTime().After(cache.Time)
+		if !lookup || (time.Since(cache.Time) < imageMetadataRetry && !loggedIn) {
+			return nil, errors.New(cache.Error)
+		}
+	}
+	if id == "" && !lookup {
+		return nil, nil
+	}
+
+	metadata, err := d.readImageMetadata(image, id != "")
+	// local images are inspected again on failure
+	if err != nil && id != "" {
+		return nil, err
+	}
+	cache = imageMetadataCache{ID: id, Metadata: metadata, Time: time.Now()}
+	if err != nil {
+		cache.Error = err.Error()
+	}
+	// not worth printing in dry-run mode
+	write := func() error { return writeJSON(path, cache) }
+	if err := hostChange("", write); err != nil {
+		log.Debug().Err(err).Msg("cannot cache image metadata")
+	}
+
+	return metadata, err
+}
+
+// return the metadata entries of the image, from the local image or from its
+// registry if it has not been pulled yet
+func (d *DevContainer) readImageMetadata(image string, local bool) ([]map[string]interface{}, error) {
+	var label string
+	var err error
+	if local {
+		cmdArgs := []string{dockerBin, "image", "inspect"}
+		cmdArgs = append(cmdArgs, "--format", `{{ index .Config.Labels "`+metadataLabel+`" }}`)
+		cmdArgs = append(cmdArgs, image)
+		if label, err = d._ExecCmd(cmdArgs, true); err != nil {
+			return nil, err
+		}
+	} else {
+		ref, err := ParseOCIRef(image)
+		// images of the default registry are not looked up
+		if err != nil {
+			return nil, nil
+		}
+		labels, err := NewOCIRegistry().ImageLabels(ref)
+		if err != nil {
+			return nil, err
+		}
+		label = labels[metadataLabel]
+	}
+	label = strings.TrimSpace(label)
+	if label == "" || label == "<no value>" {
+		return nil, nil
+	}
+
+	// either a list of entries or a single one
+	metadata := []map[string]interface{}{}
+	if err := json.Unmarshal([]byte(label), &metadata); err != nil {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(label), &entry); err != nil {
+			return nil, fmt.Errorf("cannot parse %s label: %w", metadataLabel, err)
+		}
+		metadata = append(metadata, entry)
+	}
+
+	return metadata, nil
+}
+
+// MergeImageMetadata merge the metadata of the image into the configuration:
+// configuration settings take precedence, then the last entries, lists are
+// appended and maps are merged. The registry of an image which is not pulled
+// is only looked up when asked to, the metadata being cached otherwise.
+func (d *DevContainer) MergeImageMetadata(lookup bool) {
+	if !d.Config.IsSet("image") {
+		return
+	}
+	metadata, err := d.imageMetadata(d.Config.GetString("image"), lookup)
+	if err != nil {
+		log.Warn().Err(err).Msg("cannot read image metadata")
+		return
+	}
+	for _, entry := range lo.Reverse(metadata) {
+		for key, value := range entry {
+			switch {
+			case !lo.Contains(metadataProperties, key):
+			case lo.Contains([]string{"capAdd", "forwardPorts", "mounts", "securityOpt"}, key):
+				values, _ := value.([]interface{})
+				current, _ := d.Config.Get(key).([]interface{})
+				merged := lo.UniqBy(append(current, values...), func(v interface{}) string { return fmt.Sprint(v) })
+				d.Config.Set(key, merged)
+			case lo.Contains([]string{"containerEnv", "remoteEnv"}, key):
+				values, _ := value.(map[string]interface{})
+				env := lo.MapValues(values, func(v interface{}, _ string) string { return fmt.Sprint(v) })
+				for k, v := range d.Config.GetStringMapString(key) {
+					env[k] = v
+				}
+				d.Config.Set(key, env)
+			case lo.Contains([]string{"customizations", "hostRequirements", "portsAttributes"}, key):
+				values, _ := value.(map[string]interface{})
+				flat := map[string]interface{}{}
+				flattenSettings(key+".", values, flat)
+				for k, v := range flat {
+					if !d.Config.IsSet(k) {
+						d.Config.Set(k, v)
+					}
+				}
+			case !d.Config.IsSet(key):
+				d.Config.Set(key, value)
+			}
+		}
+	}
+}
+
+// return the metadata entry of the devcontainer.json file, without the user
+// configuration nor the image metadata
+func (d *DevContainer) metadataEntry() (map[string]interface{}, error) {
+	settings, err := d.fileSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.PickByKeys(settings, metadataProperties), nil
+}
+
+// return the settings of the devcontainer.json file, with their keys as they
+// are written, unlike the configuration
+func (d *DevContainer) fileSettings() (map[string]interface{}, error) {
+	// the engine may have changed the working directory
+	configDir := absPath(d.ConfigDir, d.WorkingDirectoryPath)
+	src, err := os.ReadFile(filepath.Join(configDir, "devcontainer.json"))
+	if err != nil {
+		return nil, err
+	}
+	root, err := ParseJSONC(src)
+	if err != nil {
+		return nil, err
+	}
+	settings, _ := root.Interface().(map[string]interface{})
+
+	return settings, nil
+}
+
+// fetch the features of the devcontainer.json file into the directory, in
+// their installation order, even in dry-run mode as templates are, since the
+// Dockerfile installing them depends on their metadata
+func (d *DevContainer) loadFeatures(dir string) ([]*Feature, error) {
+	settings, err := d.fileSettings()
+	if err != nil {
+		return nil, err
+	}
+	configured, _ := settings["features"].(map[string]interface{})
+	if len(configured) == 0 {
+		return nil, nil
+	}
+	order, _ := settings["overrideFeatureInstallOrder"].([]interface{})
+	refs := sortFeatures(lo.Keys(configured), lo.Map(order, func(x interface{}, _ int) string { return fmt.Sprint(x) }))
+
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	configDir := absPath(d.ConfigDir, d.WorkingDirectoryPath)
+	features := []*Feature{}
+	for i, ref := range refs {
+		f, err := LoadFeature(ref, configDir, filepath.Join(dir, fmt.Sprint(i)))
+		if err != nil {
+			return nil, fmt.Errorf("cannot load feature %s: %w", ref, err)
+		}
+		f.Values = configured[ref]
+		features = append(features, f)
+	}
+
+	return features, nil
+}
+
+// return the user of the image, pulling it if needed, or an empty string if it
+// cannot be inspected
+func (d *DevContainer) imageUser(image string) string {
+	inspect := []string{dockerBin, "image", "inspect", "--format", "{{ .Config.User }}", image}
+	out, err := d._ExecCmd(inspect, true)
+	if err != nil {
+		if _, err := d._ExecCmd([]string{dockerBin, "image", "pull", image}, false); err == nil {
+			out, _ = d._ExecCmd(inspect, true)
+		}
+	}
+
+	return strings.TrimSpace(out)
+}
+
+// return the base image of the target stage of the Dockerfile, or of the last
+// one, following the stages built from other ones, or an empty string if it
+// cannot be determined
+func dockerfileBaseImage(dockerfile string, target string) string {
+	stages := map[string]string{}
+	base := ""
+	for _, instruction := range dockerfileInstructions(dockerfile) {
+		fields := lo.Filter(strings.Fields(instruction), func(x string, _ int) bool { return !strings.HasPrefix(x, "--") })
+		if len(fields) < 2 || strings.ToUpper(fields[0]) != "FROM" {
+			continue
+		}
+		base = fields[1]
+		if image, ok := stages[strings.ToLower(base)]; ok {
+			base = image
+		}
+		if len(fields) >= 4 && strings.ToUpper(fields[2]) == "AS" {
+			stages[strings.ToLower(fields[3])] = base
+			if strings.EqualFold(fields[3], target) {
+				break
+			}
+		}
+	}
+	if strings.Contains(base, "$") || base == "scratch" {
+		return ""
+	}
+
+	return base
+}
+
+// COMMANDS
+
+func (d *DevContainer) Prebuild(_ *cobra.Command, args []string) {
+	ref := args[0]
+	docker, ok := d.Engine.(*Docker)
+	if !ok {
+		log.Fatal().Msg("prebuild is not supported with compose")
+	}
+
+	dir := filepath.Join(d.StateDir(), "prebuild")
+	features, err := d.loadFeatures(filepath.Join(dir, "features"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load features")
+	}
+
+	build := docker.ImageBuild
+	base := d.Config.GetString("image")
+	if build.Dockerfile != "" {
+		if base = dockerfileBaseImage(build.Dockerfile, build.Target); base == "" {
+			log.Warn().Msg("cannot determine the base image, its metadata is not kept")
+		}
+	}
+
+	// the metadata of the base image comes first, then the features ones
+	metadata := []map[string]interface{}{}
+	if base != "" {
+		baseMetadata, err := d.imageMetadata(base, true)
+		if err != nil {
+			log.Warn().Err(err).Str("image", base).Msg("cannot read image metadata, it is not kept")
+		}
+		metadata = append(metadata, baseMetadata...)
+	}
+	for _, f := range features {
+		metadata = append(metadata, f.MetadataEntry())
+	}
+	entry, err := d.metadataEntry()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot read devcontainer settings")
+	}
+	metadata = append(metadata, entry)
+	label, err := json.Marshal(metadata)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot write image metadata")
+	}
+
+	if build.Dockerfile == "" || len(features) > 0 {
+		// the image is rebuilt to store the metadata, and the features are
+		// installed on top of the one built from the Dockerfile
+		from := base
+		if build.Dockerfile != "" {
+			d.Timings.Time("build", func() {
+				if _, err := docker.Build(); err != nil {
+					log.Fatal().Err(err).Msg("cannot build")
+				}
+			})
+			from = docker.Image
+		}
+		dockerfile := "FROM " + from + "\n"
+		if len(features) > 0 {
+			imageUser := d.imageUser(from)
+			if imageUser == "" {
+				imageUser = "root"
+			}
+			containerUser := lo.Ternary(d.Config.IsSet("containerUser"), d.Config.GetString("containerUser"), imageUser)
+			remoteUser := lo.Ternary(d.Config.IsSet("remoteUser"), d.Config.GetString("remoteUser"), containerUser)
+			dockerfile = featuresDockerfile(from, imageUser, containerUser, remoteUser, features)
+		}
+		build = DockerImageBuild{Dockerfile: filepath.Join(dir, "Dockerfile"), Context: dir, Platform: build.Platform}
+		if err := writeFile(build.Dockerfile, []byte(dockerfile)); err != nil {
+			log.Fatal().Err(err).Msg("cannot create build context")
+		}
+	}
+
+	d.Timings.Time("build", func() {
+		if _, err := d._ExecCmd(docker.BuildArgs(build, ref, metadataLabel+"="+string(label)), false); err != nil {
+			log.Fatal().Err(err).Msg("cannot build")
+		}
+	})
+	if prebuildPush {
+		d.Timings.Time("push", func() {
+			if _, err := d._ExecCmd([]string{dockerBin, "image", "push", ref}, false); err != nil {
+				log.Fatal().Err(err).Msg("cannot push")
+			}
+		})
+	}
+	d.ReportTimings()
+}
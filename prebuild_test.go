@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestDockerfileBaseImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		target     string
+		want       string
+	}{
+		{"single stage", "FROM alpine:3.18\nRUN apk add git\n", "", "alpine:3.18"},
+		{"last stage", "FROM golang:1.21 AS build\nFROM debian:12\n", "", "debian:12"},
+		{"target stage", "FROM golang:1.21 AS build\nFROM debian:12\n", "build", "golang:1.21"},
+		{"platform flag", "FROM --platform=$BUILDPLATFORM node:20 AS base\n", "", "node:20"},
+		{"stage from stage", "FROM node:20 AS base\nFROM base AS dev\nFROM dev\n", "", "node:20"},
+		{"case insensitive", "from ubuntu:22.04 as Base\nfrom base\n", "BASE", "ubuntu:22.04"},
+		{"continued line", "FROM \\\n  python:3.12\n", "", "python:3.12"},
+		{"build argument", "ARG VERSION=3.18\nFROM alpine:$VERSION\n", "", ""},
+		{"scratch", "FROM scratch\nCOPY app /\n", "", ""},
+		{"no from", "RUN true\n", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Dockerfile")
+			if err := os.WriteFile(path, []byte(tt.dockerfile), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := dockerfileBaseImage(path, tt.target); got != tt.want {
+				t.Errorf("dockerfileBaseImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeImageMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+		label  string
+		want   map[string]interface{}
+	}{
+		{
+			name:   "settings take precedence",
+			config: map[string]interface{}{"remoteUser": "me"},
+			label:  `[{"remoteUser": "vscode", "containerUser": "root"}]`,
+			want:   map[string]interface{}{"remoteUser": "me", "containerUser": "root"},
+		},
+		{
+			name:  "last entry takes precedence",
+			label: `[{"remoteUser": "first"}, {"remoteUser": "last"}]`,
+			want:  map[string]interface{}{"remoteUser": "last"},
+		},
+		{
+			name:  "single entry",
+			label: `{"postCreateCommand": "make"}`,
+			want:  map[string]interface{}{"postCreateCommand": "make"},
+		},
+		{
+			name:   "lists appended",
+			config: map[string]interface{}{"capAdd": []interface{}{"SYS_PTRACE"}},
+			label:  `[{"capAdd": ["NET_ADMIN", "SYS_PTRACE"]}]`,
+			want:   map[string]interface{}{"capAdd": []interface{}{"SYS_PTRACE", "NET_ADMIN"}},
+		},
+		{
+			name:   "maps merged",
+			config: map[string]interface{}{"containerEnv": map[string]interface{}{"editor": "vim"}},
+			label:  `[{"containerEnv": {"editor": "nano", "pager": "less"}}]`,
+			want:   map[string]interface{}{"containerEnv": map[string]string{"editor": "vim", "pager": "less"}},
+		},
+		{
+			name:   "customizations merged",
+			config: map[string]interface{}{"customizations.devc.forwardSshAgent": true},
+			label:  `[{"customizations": {"devc": {"forwardSshAgent": false, "shell": "zsh"}}}]`,
+			want: map[string]interface{}{
+				"customizations.devc.forwardSshAgent": true,
+				"customizations.devc.shell":           "zsh",
+			},
+		},
+		{
+			name:  "other properties ignored",
+			label: `[{"image": "other", "build": {"dockerfile": "Dockerfile"}}]`,
+			want:  map[string]interface{}{"image": "base", "build": nil},
+		},
+		{
+			name: "no metadata",
+			want: map[string]interface{}{"remoteUser": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the metadata is cached by image
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			d := DevContainer{
+				Config: viper.New(),
+				_ExecCmd: func(command []string, _ bool, _ ...io.Writer) (string, error) {
+					switch command[2] {
+					case "ls":
+						return "1234", nil
+					case "inspect":
+						return tt.label, nil
+					}
+					return "", fmt.Errorf("unexpected command %q", command)
+				},
+			}
+			d.Config.Set("image", "base")
+			for key, value := range tt.config {
+				d.Config.Set(key, value)
+			}
+			d.MergeImageMetadata(true)
+			for key, want := range tt.want {
+				if got := d.Config.Get(key); fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
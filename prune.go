@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+// staleResource is a devc container or image which can be removed
+type staleResource struct {
+	Kind     string
+	ID       string
+	Folder   string
+	LastUsed time.Time
+	Size     uint64
+	Reason   string
+}
+
+// return the most recent of the times
+func latest(times ...time.Time) time.Time {
+	last := time.Time{}
+	for _, t := range times {
+		if t.After(last) {
+			last = t
+		}
+	}
+
+	return last
+}
+
+// return why a resource of the local folder, if known, last used at the given
+// time, is stale, or an empty string if it is not
+func staleReason(folder string, lastUsed time.Time, days int) string {
+	if _, err := os.Stat(folder); folder != "" && errors.Is(err, os.ErrNotExist) {
+		return "folder deleted"
+	}
+	if days > 0 && time.Since(lastUsed) > time.Duration(days)*24*time.Hour {
+		return fmt.Sprintf("unused for %s", plural(int(time.Since(lastUsed).Hours()/24), "day"))
+	}
+
+	return ""
+}
+
+// return the inspection of the resources matching the filter, one JSON object
+// per line
+func (d *DevContainer) inspectFiltered(kind string, filter string, inspectArgs ...string) ([]string, error) {
+	cmdArgs := []string{dockerBin, kind, "ls", "--quiet", "--filter", filter}
+	if kind == "container" {
+		cmdArgs = append(cmdArgs, "--all")
+	}
+	out, err := d._ExecCmd(cmdArgs, true)
+	if err != nil {
+		return nil, err
+	}
+	ids := lo.Uniq(lo.Compact(strings.Split(out, "\n")))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	cmdArgs = []string{dockerBin, kind, "inspect"}
+	cmdArgs = append(cmdArgs, inspectArgs...)
+	cmdArgs = append(cmdArgs, "--format", "{{ json . }}")
+	cmdArgs = append(cmdArgs, ids...)
+	out, err = d._ExecCmd(cmdArgs, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.Compact(strings.Split(out, "\n")), nil
+}
+
+// StaleResources return the devc containers and images whose local folder no
+// longer exists or which have not been used for the given number of days
+func (d *DevContainer) StaleResources(days int) ([]staleResource, error) {
+	stale := []staleResource{}
+	// last use of the images by the containers which are kept
+	imagesUsed := map[string]time.Time{}
+
+	lines, err := d.inspectFiltered("container", "label=devcontainer.local_folder", "--size")
+	if err != nil {
+		return nil, fmt.Errorf("cannot list containers: %w", err)
+	}
+	for _, line := range lines {
+		container := containerInspect{}
+		if err := json.Unmarshal([]byte(line), &container); err != nil {
+			return nil, fmt.Errorf("cannot parse container: %w", err)
+		}
+		folder := container.Config.Labels["devcontainer.local_folder"]
+		lastUsed := latest(container.Created, container.State.StartedAt, container.State.FinishedAt)
+		reason := staleReason(folder, lastUsed, days)
+		if container.State.Running {
+			lastUsed, reason = time.Now(), ""
+		}
+		if reason == "" {
+			imagesUsed[container.Image] = latest(imagesUsed[container.Image], lastUsed)
+			continue
+		}
+		stale = append(stale, staleResource{"container", container.ID, folder, lastUsed, container.SizeRw, reason})
+	}
+
+	// the images are shared by worktrees, so a deleted folder does not make
+	// them stale even if labelled with it, and the ones built by older devc
+	// versions and by compose are recognized by their name
+	filters := []string{"label=" + buildHashLabel, "reference=vsc-*", "reference=*_devcontainer[-_]*"}
+	listed := map[string]bool{}
+	for _, filter := range filters {
+		lines, err = d.inspectFiltered("image", filter)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list images: %w", err)
+		}
+		for _, line := range lines {
+			image := imageInspect{}
+			if err := json.Unmarshal([]byte(line), &image); err != nil {
+				return nil, fmt.Errorf("cannot parse image: %w", err)
+			}
+			// images of the kept containers are kept too
+			if _, ok := imagesUsed[image.ID]; ok || listed[image.ID] {
+				continue
+			}
+			listed[image.ID] = true
+			lastUsed := latest(image.Created, image.Metadata.LastTagTime)
+			if reason := staleReason("", lastUsed, days); reason != "" {
+				stale = append(stale, staleResource{"image", image.ID, "", lastUsed, image.Size, reason})
+			}
+		}
+	}
+
+	return stale, nil
+}
+
+// ask the question, returning true if answered yes
+func confirm(question string) bool {
+	fmt.Print(question + " [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	return lo.Contains([]string{"y", "yes"}, strings.ToLower(strings.TrimSpace(answer)))
+}
+
+// COMMANDS
+
+func (d *DevContainer) Prune(_ *cobra.Command, _ []string) {
+	stale, err := d.StaleResources(pruneDays)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot find stale resources")
+	}
+	if len(stale) == 0 {
+		log.Info().Msg("nothing to prune")
+		return
+	}
+
+	var size uint64
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tID\tLOCAL FOLDER\tLAST USED\tSIZE\tREASON")
+	for _, r := range stale {
+		id := strings.TrimPrefix(r.ID, "sha256:")
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Kind, id, lo.Ternary(r.Folder != "", r.Folder, "-"), r.LastUsed.Local().Format("2006-01-02"), formatSize(r.Size), r.Reason)
+		size += r.Size
+	}
+	w.Flush()
+	// image layers may be shared with other images
+	fmt.Printf("\nReclaimable: up to %s\n", formatSize(size))
+
+	if !pruneForce && !rootDryRun && !confirm("Remove them?") {
+		return
+	}
+	// the images of the removed containers are removed after them
+	failed := false
+	for _, kind := range []string{"container", "image"} {
+		for _, r := range stale {
+			if r.Kind != kind {
+				continue
+			}
+			cmdArgs := []string{dockerBin, kind, "rm"}
+			if kind == "container" {
+				cmdArgs = append(cmdArgs, "--volumes")
+			}
+			if _, err := d._ExecCmd(append(cmdArgs, r.ID), false); err != nil {
+				log.Error().Err(err).Str("id", r.ID).Msgf("cannot remove %s", kind)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// RunOptions are the runArgs options translated for every engine
+type RunOptions struct {
+	AddHosts []string
+	CapDrop  []string
+	Devices  []string
+	EnvFiles []string
+	Hostname string
+	Name     string
+	Network  string
+	ShmSize  string
+	Ulimits  []string
+}
+
+// runArgs flags taking a value, with their aliases
+var runArgsFlags = map[string]string{
+	"--add-host": "--add-host",
+	"--cap-drop": "--cap-drop",
+	"--device":   "--device",
+	"--env-file": "--env-file",
+	"--hostname": "--hostname",
+	"-h":         "--hostname",
+	"--name":     "--name",
+	"--net":      "--network",
+	"--network":  "--network",
+	"--shm-size": "--shm-size",
+	"--ulimit":   "--ulimit",
+}
+
+// ParseRunArgs parse the supported runArgs flags, returning the other
+// arguments as they are
+func ParseRunArgs(args []string) (RunOptions, []string) {
+	options := RunOptions{}
+	others := []string{}
+	for i := 0; i < len(args); i++ {
+		flag, value, inline := strings.Cut(args[i], "=")
+		name, ok := runArgsFlags[flag]
+		if !ok {
+			others = append(others, args[i])
+			continue
+		}
+		if !inline {
+			if i+1 >= len(args) {
+				others = append(others, args[i])
+				continue
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "--add-host":
+			options.AddHosts = append(options.AddHosts, value)
+		case "--cap-drop":
+			options.CapDrop = append(options.CapDrop, value)
+		case "--device":
+			options.Devices = append(options.Devices, value)
+		case "--env-file":
+			options.EnvFiles = append(options.EnvFiles, value)
+		case "--hostname":
+			options.Hostname = value
+		case "--name":
+			options.Name = value
+		case "--network":
+			options.Network = value
+		case "--shm-size":
+			options.ShmSize = value
+		case "--ulimit":
+			options.Ulimits = append(options.Ulimits, value)
+		}
+	}
+
+	return options, others
+}
+
+// Args return the options as docker command line flags, without the name
+func (o RunOptions) Args() (args []string) {
+	if o.Network != "" {
+		args = append(args, "--network", o.Network)
+	}
+	for _, file := range o.EnvFiles {
+		args = append(args, "--env-file", file)
+	}
+	for _, device := range o.Devices {
+		args = append(args, "--device", device)
+	}
+	if o.ShmSize != "" {
+		args = append(args, "--shm-size", o.ShmSize)
+	}
+	for _, host := range o.AddHosts {
+		args = append(args, "--add-host", host)
+	}
+	if o.Hostname != "" {
+		args = append(args, "--hostname", o.Hostname)
+	}
+	for _, ulimit := range o.Ulimits {
+		args = append(args, "--ulimit", ulimit)
+	}
+	for _, cap := range o.CapDrop {
+		args = append(args, "--cap-drop", cap)
+	}
+
+	return args
+}
+
+// Compose add the options to the compose service, and return the top-level
+// networks it refers to
+func (o RunOptions) Compose(service map[string]interface{}) map[string]interface{} {
+	networks := map[string]interface{}{}
+	switch {
+	case o.Network == "":
+	case lo.Contains([]string{"bridge", "host", "none"}, o.Network),
+		strings.HasPrefix(o.Network, "container:"),
+		strings.HasPrefix(o.Network, "service:"):
+		service["network_mode"] = o.Network
+	default:
+		// keep the project network to reach the other services
+		service["networks"] = []string{"default", o.Network}
+		networks[o.Network] = map[string]interface{}{"external": true}
+	}
+	if len(o.EnvFiles) > 0 {
+		service["env_file"] = o.EnvFiles
+	}
+	if len(o.Devices) > 0 {
+		service["devices"] = o.Devices
+	}
+	if o.ShmSize != "" {
+		service["shm_size"] = o.ShmSize
+	}
+	if len(o.AddHosts) > 0 {
+		service["extra_hosts"] = o.AddHosts
+	}
+	if o.Hostname != "" {
+		service["hostname"] = o.Hostname
+	}
+	if o.Name != "" {
+		service["container_name"] = o.Name
+	}
+	if len(o.Ulimits) > 0 {
+		ulimits := map[string]interface{}{}
+		for _, ulimit := range o.Ulimits {
+			name, value, _ := strings.Cut(ulimit, "=")
+			ulimits[name] = composeUlimit(value)
+		}
+		service["ulimits"] = ulimits
+	}
+	if len(o.CapDrop) > 0 {
+		service["cap_drop"] = o.CapDrop
+	}
+
+	return networks
+}
+
+// convert a soft[:hard] ulimit to its compose form
+func composeUlimit(value string) interface{} {
+	soft, hard, found := strings.Cut(value, ":")
+	softValue, err := strconv.ParseInt(soft, 10, 64)
+	if err != nil {
+		return value
+	}
+	if !found {
+		return softValue
+	}
+	hardValue, err := strconv.ParseInt(hard, 10, 64)
+	if err != nil {
+		return value
+	}
+
+	return map[string]int64{"soft": softValue, "hard": hardValue}
+}
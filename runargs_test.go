@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseRunArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		options RunOptions
+		others  []string
+	}{
+		{"separate value", []string{"--network", "host"}, RunOptions{Network: "host"}, []string{}},
+		{"inline value", []string{"--shm-size=1g"}, RunOptions{ShmSize: "1g"}, []string{}},
+		{"alias", []string{"-h", "box", "--net=none"}, RunOptions{Hostname: "box", Network: "none"}, []string{}},
+		{"repeated", []string{"--add-host", "a:1.2.3.4", "--add-host=b:5.6.7.8"}, RunOptions{AddHosts: []string{"a:1.2.3.4", "b:5.6.7.8"}}, []string{}},
+		{"lists", []string{"--device", "/dev/fuse", "--cap-drop", "ALL", "--ulimit", "nofile=1024", "--env-file", ".env"}, RunOptions{Devices: []string{"/dev/fuse"}, CapDrop: []string{"ALL"}, Ulimits: []string{"nofile=1024"}, EnvFiles: []string{".env"}}, []string{}},
+		{"unknown flags kept", []string{"--gpus", "all", "--name", "dev", "--rm"}, RunOptions{Name: "dev"}, []string{"--gpus", "all", "--rm"}},
+		{"missing value", []string{"--network"}, RunOptions{}, []string{"--network"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, others := ParseRunArgs(tt.args)
+			if fmt.Sprintf("%+v", options) != fmt.Sprintf("%+v", tt.options) {
+				t.Errorf("ParseRunArgs() options = %+v, want %+v", options, tt.options)
+			}
+			if fmt.Sprint(others) != fmt.Sprint(tt.others) {
+				t.Errorf("ParseRunArgs() others = %q, want %q", others, tt.others)
+			}
+		})
+	}
+}
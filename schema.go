@@ -0,0 +1,448 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// subset of the devcontainer.json schema, cf.
+// https://github.com/devcontainers/spec/tree/main/schemas, the properties it
+// does not know being only reported as warnings
+//
+//go:embed schema/devContainer.schema.json
+var devContainerSchema []byte
+
+// ValidationError is a schema violation at the given path of the document, or
+// only a warning for unknown properties
+type ValidationError struct {
+	Path    []interface{}
+	Key     bool
+	Message string
+	Warning bool
+}
+
+// schemaValidator validates values against a JSON schema, supporting the
+// keywords used by the devcontainer.json schemas: $ref, type, const, enum,
+// allOf, anyOf, oneOf, if/then/else, not, properties, patternProperties,
+// additionalProperties, unevaluatedProperties, required, items, minItems,
+// uniqueItems, pattern, minLength, minimum and maximum
+type schemaValidator struct {
+	root   map[string]interface{}
+	errors []ValidationError
+}
+
+// ValidateConfig validate the document against the devcontainer.json schema
+func ValidateConfig(value interface{}) []ValidationError {
+	var root map[string]interface{}
+	if err := json.Unmarshal(devContainerSchema, &root); err != nil {
+		panic(err)
+	}
+	v := &schemaValidator{root: root}
+	v.validate(root, value, nil)
+
+	return v.errors
+}
+
+func (v *schemaValidator) fail(path []interface{}, key bool, format string, args ...interface{}) {
+	v.errors = append(v.errors, ValidationError{
+		Path:    append([]interface{}{}, path...),
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *schemaValidator) warn(path []interface{}, key bool, format string, args ...interface{}) {
+	v.fail(path, key, format, args...)
+	v.errors[len(v.errors)-1].Warning = true
+}
+
+// return true if there are errors, not only warnings
+func (v *schemaValidator) failed() bool {
+	return lo.SomeBy(v.errors, func(e ValidationError) bool { return !e.Warning })
+}
+
+// return the length of the deepest error path
+func (v *schemaValidator) depth() int {
+	depth := 0
+	for _, e := range v.errors {
+		if len(e.Path) > depth {
+			depth = len(e.Path)
+		}
+	}
+
+	return depth
+}
+
+// resolve a local reference like #/definitions/name
+func (v *schemaValidator) resolve(ref string) map[string]interface{} {
+	var node interface{} = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, _ := node.(map[string]interface{})
+		node = m[part]
+	}
+	schema, _ := node.(map[string]interface{})
+
+	return schema
+}
+
+// return the JSON type of the value
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// return true if the value is of one of the types
+func matchType(value interface{}, types interface{}) bool {
+	allowed := []string{}
+	switch types := types.(type) {
+	case string:
+		allowed = append(allowed, types)
+	case []interface{}:
+		for _, t := range types {
+			allowed = append(allowed, fmt.Sprint(t))
+		}
+	}
+	actual := jsonType(value)
+
+	return lo.Contains(allowed, actual) || (actual == "integer" && lo.Contains(allowed, "number"))
+}
+
+// describe what the schema expects, for error messages
+func (v *schemaValidator) describe(schema map[string]interface{}) string {
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = v.resolve(ref)
+	}
+	switch {
+	case schema["type"] != nil:
+		if types, ok := schema["type"].([]interface{}); ok {
+			return strings.Join(lo.Map(types, func(t interface{}, _ int) string { return fmt.Sprint(t) }), " or ")
+		}
+		if schema["type"] == "array" {
+			if items, ok := schema["items"].(map[string]interface{}); ok {
+				return "array of " + v.describe(items)
+			}
+		}
+		return fmt.Sprint(schema["type"])
+	case schema["enum"] != nil:
+		return "one of " + enumString(schema["enum"].([]interface{}))
+	case schema["anyOf"] != nil || schema["oneOf"] != nil:
+		branches, ok := schema["anyOf"].([]interface{})
+		if !ok {
+			branches = schema["oneOf"].([]interface{})
+		}
+		return strings.Join(lo.Map(branches, func(b interface{}, _ int) string {
+			return v.describe(b.(map[string]interface{}))
+		}), " or ")
+	}
+
+	return "value"
+}
+
+func enumString(values []interface{}) string {
+	return strings.Join(lo.Map(values, func(e interface{}, _ int) string {
+		b, _ := json.Marshal(e)
+		return string(b)
+	}), ", ")
+}
+
+// validate the value against the schema, returning the properties of an
+// object value evaluated by the schema and its subschemas, which
+// unevaluatedProperties does not apply to
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path []interface{}) map[string]bool {
+	evaluated := map[string]bool{}
+	merge := func(keys map[string]bool) {
+		for key := range keys {
+			evaluated[key] = true
+		}
+	}
+
+	// other keywords apply along with the reference
+	if ref, ok := schema["$ref"].(string); ok {
+		merge(v.validate(v.resolve(ref), value, path))
+	}
+
+	if types, ok := schema["type"]; ok && !matchType(value, types) {
+		v.fail(path, false, "expected %s, found %s", v.describe(schema), jsonType(value))
+		return evaluated
+	}
+
+	if constant, ok := schema["const"]; ok && !jsonEqual(constant, value) {
+		v.fail(path, false, "expected %s", enumString([]interface{}{constant}))
+		return evaluated
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		if !lo.ContainsBy(enum, func(e interface{}) bool { return jsonEqual(e, value) }) {
+			v.fail(path, false, "expected one of %s", enumString(enum))
+			return evaluated
+		}
+	}
+
+	if branches, ok := schema["allOf"].([]interface{}); ok {
+		for _, b := range branches {
+			merge(v.validate(b.(map[string]interface{}), value, path))
+		}
+	}
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		if branches, ok := schema[keyword].([]interface{}); ok {
+			keys, matched := v.validateBranches(schema, keyword, branches, value, path)
+			if !matched {
+				return evaluated
+			}
+			merge(keys)
+		}
+	}
+
+	if condition, ok := schema["if"].(map[string]interface{}); ok {
+		sub := &schemaValidator{root: v.root}
+		keys := sub.validate(condition, value, path)
+		if !sub.failed() {
+			merge(keys)
+			if then, ok := schema["then"].(map[string]interface{}); ok {
+				merge(v.validate(then, value, path))
+			}
+		} else if otherwise, ok := schema["else"].(map[string]interface{}); ok {
+			merge(v.validate(otherwise, value, path))
+		}
+	}
+
+	if not, ok := schema["not"].(map[string]interface{}); ok {
+		sub := &schemaValidator{root: v.root}
+		sub.validate(not, value, path)
+		if !sub.failed() {
+			v.fail(path, false, "expected not %s", v.describe(not))
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		patterns, _ := schema["patternProperties"].(map[string]interface{})
+		patternKeys := lo.Keys(patterns)
+		sort.Strings(patternKeys)
+		keys := lo.Keys(value)
+		sort.Strings(keys)
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if _, ok := value[fmt.Sprint(r)]; !ok {
+					v.fail(path, false, "missing required property %q", r)
+				}
+			}
+		}
+		for _, key := range keys {
+			keyPath := append(append([]interface{}{}, path...), key)
+			matched := false
+			if sub, ok := properties[key].(map[string]interface{}); ok {
+				v.validate(sub, value[key], keyPath)
+				matched = true
+			}
+			for _, pattern := range patternKeys {
+				if regexp.MustCompile(pattern).MatchString(key) {
+					v.validate(patterns[pattern].(map[string]interface{}), value[key], keyPath)
+					matched = true
+				}
+			}
+			if !matched {
+				matched = v.validateExtra(schema["additionalProperties"], value[key], keyPath)
+			}
+			if matched {
+				evaluated[key] = true
+			}
+		}
+		if unevaluated, ok := schema["unevaluatedProperties"]; ok {
+			for _, key := range keys {
+				if !evaluated[key] {
+					v.validateExtra(unevaluated, value[key], append(append([]interface{}{}, path...), key))
+					evaluated[key] = true
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				v.validate(items, item, append(append([]interface{}{}, path...), i))
+			}
+		}
+		if minItems, ok := schema["minItems"].(float64); ok && float64(len(value)) < minItems {
+			v.fail(path, false, "expected at least %v items", minItems)
+		}
+		if unique, _ := schema["uniqueItems"].(bool); unique {
+			for i := range value {
+				for j := 0; j < i; j++ {
+					if jsonEqual(value[i], value[j]) {
+						v.fail(append(append([]interface{}{}, path...), i), false, "duplicate of item %d", j)
+						break
+					}
+				}
+			}
+		}
+	case string:
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(value) {
+			v.fail(path, false, "%q does not match pattern %s", value, pattern)
+		}
+		if minLength, ok := schema["minLength"].(float64); ok && float64(len([]rune(value))) < minLength {
+			v.fail(path, false, "expected at least %v characters", minLength)
+		}
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && value < minimum {
+			v.fail(path, false, "%v is lower than %v", value, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && value > maximum {
+			v.fail(path, false, "%v is greater than %v", value, maximum)
+		}
+	}
+
+	return evaluated
+}
+
+// validate a property against additionalProperties or unevaluatedProperties,
+// returning true if the keyword applies to it
+func (v *schemaValidator) validateExtra(extra interface{}, value interface{}, path []interface{}) bool {
+	switch extra := extra.(type) {
+	case bool:
+		if !extra {
+			v.warn(path, true, "unknown property %q", path[len(path)-1])
+		}
+		return true
+	case map[string]interface{}:
+		v.validate(extra, value, path)
+		return true
+	}
+
+	return false
+}
+
+// validate the value against the anyOf or oneOf branches of the same type,
+// keeping the result of the branch with the fewest errors and warnings, as
+// unknown properties are only warnings
+func (v *schemaValidator) validateBranches(schema map[string]interface{}, keyword string, branches []interface{}, value interface{}, path []interface{}) (map[string]bool, bool) {
+	subs := make([]*schemaValidator, len(branches))
+	keys := make([]map[string]bool, len(branches))
+	for i, b := range branches {
+		subs[i] = &schemaValidator{root: v.root}
+		keys[i] = subs[i].validate(b.(map[string]interface{}), value, path)
+	}
+
+	candidates := lo.Filter(lo.Range(len(branches)), func(i int, _ int) bool {
+		s := branches[i].(map[string]interface{})
+		if ref, ok := s["$ref"].(string); ok && s["type"] == nil {
+			s = v.resolve(ref)
+		}
+		return s["type"] == nil || matchType(value, s["type"])
+	})
+	if len(candidates) == 0 {
+		v.fail(path, false, "expected %s, found %s", v.describe(schema), jsonType(value))
+		return nil, false
+	}
+	exact := lo.Filter(candidates, func(i int, _ int) bool { return len(subs[i].errors) == 0 })
+	if keyword == "oneOf" && len(exact) > 1 {
+		v.fail(path, false, "matches %d alternatives, expected only one", len(exact))
+		return nil, false
+	}
+
+	// on par, the deepest errors are the most relevant ones
+	best := lo.MinBy(candidates, func(a int, b int) bool {
+		if len(subs[a].errors) != len(subs[b].errors) {
+			return len(subs[a].errors) < len(subs[b].errors)
+		}
+		return subs[a].depth() > subs[b].depth()
+	})
+	v.errors = append(v.errors, subs[best].errors...)
+
+	return keys[best], !subs[best].failed()
+}
+
+// return true if the JSON values are equal
+func jsonEqual(a interface{}, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+
+	return string(x) == string(y)
+}
+
+// ValidateFile parse and validate the JSONC document, returning the errors
+// and the warnings formatted with their location
+func ValidateFile(path string, src []byte) (errs []string, warnings []string) {
+	root, err := ParseJSONC(src)
+	if err != nil {
+		offset := 0
+		if syntaxErr, ok := err.(*JSONSyntaxError); ok {
+			offset = syntaxErr.Offset
+		}
+		line, col := position(src, offset)
+		return []string{fmt.Sprintf("%s:%d:%d: %s", path, line, col, err)}, nil
+	}
+
+	violations := ValidateConfig(root.Interface())
+	offsets := make([]int, len(violations))
+	for i, e := range violations {
+		offset := root.Find(e.Path).Start
+		// point unknown properties to their key rather than their value
+		if e.Key && len(e.Path) > 0 {
+			if parent := root.Find(e.Path[:len(e.Path)-1]); parent.Kind == "object" {
+				if member := parent.Member(fmt.Sprint(e.Path[len(e.Path)-1])); member != nil {
+					offset = member.KeyStart
+				}
+			}
+		}
+		offsets[i] = offset
+	}
+
+	// report violations in the document order
+	indexes := lo.Range(len(violations))
+	sort.SliceStable(indexes, func(i, j int) bool { return offsets[indexes[i]] < offsets[indexes[j]] })
+	for _, i := range indexes {
+		line, col := position(src, offsets[i])
+		message := fmt.Sprintf("%s:%d:%d: %s: %s", path, line, col, jsonPath(violations[i].Path), violations[i].Message)
+		if violations[i].Warning {
+			warnings = append(warnings, message)
+		} else {
+			errs = append(errs, message)
+		}
+	}
+
+	return errs, warnings
+}
+
+// return the path as a dotted string
+func jsonPath(path []interface{}) string {
+	if len(path) == 0 {
+		return "(root)"
+	}
+	s := ""
+	for _, part := range path {
+		switch part := part.(type) {
+		case string:
+			if s != "" {
+				s += "."
+			}
+			s += part
+		case int:
+			s += fmt.Sprintf("[%d]", part)
+		}
+	}
+
+	return s
+}
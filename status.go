@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+// Status is the state of the devcontainer as seen by devc
+type Status struct {
+	Engine    string           `json:"engine"`
+	Instance  string           `json:"instance,omitempty"`
+	Built     bool             `json:"built"`
+	Created   bool             `json:"created"`
+	Running   bool             `json:"running"`
+	Outdated  bool             `json:"outdated"`
+	Image     *ImageStatus     `json:"image,omitempty"`
+	Container *ContainerStatus `json:"container,omitempty"`
+	Hooks     []HookStatus     `json:"hooks"`
+	Volumes   []MountStatus    `json:"volumes"`
+	Ports     []PortStatus     `json:"ports"`
+}
+
+// ImageStatus is the image of the devcontainer
+type ImageStatus struct {
+	ID      string    `json:"id"`
+	Tags    []string  `json:"tags"`
+	Created time.Time `json:"created"`
+	Size    uint64    `json:"size"`
+}
+
+// ContainerStatus is the container of the devcontainer
+type ContainerStatus struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	State   string    `json:"state"`
+	Created time.Time `json:"created"`
+	Started time.Time `json:"started"`
+}
+
+// HookStatus is a lifecycle command and its last run, from its log file
+type HookStatus struct {
+	Step       string     `json:"step"`
+	Configured bool       `json:"configured"`
+	LastRun    *time.Time `json:"lastRun,omitempty"`
+}
+
+// MountStatus is a volume or bind mount of the container
+type MountStatus struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// PortStatus is a port published by the engine or forwarded by devc
+type PortStatus struct {
+	Port      string `json:"port"`
+	LocalPort string `json:"localPort"`
+	Source    string `json:"source"`
+}
+
+// the fields of docker container inspect used by the status
+type containerInspect struct {
+	ID      string    `json:"Id"`
+	Name    string    `json:"Name"`
+	Image   string    `json:"Image"`
+	Created time.Time `json:"Created"`
+	SizeRw  uint64    `json:"SizeRw"`
+	Config  struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status     string    `json:"Status"`
+		Running    bool      `json:"Running"`
+		StartedAt  time.Time `json:"StartedAt"`
+		FinishedAt time.Time `json:"FinishedAt"`
+	} `json:"State"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Name        string `json:"Name"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+	} `json:"Mounts"`
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+	} `json:"NetworkSettings"`
+}
+
+// the fields of docker image inspect used by the status
+type imageInspect struct {
+	ID       string    `json:"Id"`
+	RepoTags []string  `json:"RepoTags"`
+	Created  time.Time `json:"Created"`
+	Size     uint64    `json:"Size"`
+	Config   struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	Metadata struct {
+		LastTagTime time.Time `json:"LastTagTime"`
+	} `json:"Metadata"`
+}
+
+// GetStatus return the state of the devcontainer
+func (d *DevContainer) GetStatus() (*Status, error) {
+	var err error
+	status := &Status{
+		Engine:   lo.Ternary(d.Config.IsSet("dockerComposeFile"), dockerBin+" compose", dockerBin),
+		Instance: d.Instance,
+		Hooks:    []HookStatus{},
+		Volumes:  []MountStatus{},
+		Ports:    []PortStatus{},
+	}
+	if status.Built, err = d.Engine.IsBuilt(); err != nil {
+		return nil, err
+	}
+	if status.Created, err = d.Engine.IsCreated(); err != nil {
+		return nil, err
+	}
+	if status.Running, err = d.Engine.IsRunning(); err != nil {
+		return nil, err
+	}
+
+	image, _ := d.Engine.GetImage()
+	if status.Created {
+		status.Outdated = d.IsOutdated()
+		out, err := d.Engine.Inspect("{{ json . }}")
+		if err != nil {
+			return nil, err
+		}
+		container := containerInspect{}
+		if err := json.Unmarshal([]byte(out), &container); err != nil {
+			return nil, fmt.Errorf("cannot parse container: %w", err)
+		}
+		image = container.Image
+		status.Container = &ContainerStatus{
+			ID:      container.ID,
+			Name:    strings.TrimPrefix(container.Name, "/"),
+			State:   container.State.Status,
+			Created: container.Created,
+			Started: container.State.StartedAt,
+		}
+		for _, mount := range container.Mounts {
+			source := lo.Ternary(mount.Type == "volume", mount.Name, mount.Source)
+			status.Volumes = append(status.Volumes, MountStatus{mount.Type, source, mount.Destination})
+		}
+		for port, bindings := range container.NetworkSettings.Ports {
+			for _, binding := range bindings {
+				status.Ports = append(status.Ports, PortStatus{port, binding.HostIP + ":" + binding.HostPort, "published"})
+			}
+		}
+		sort.Slice(status.Ports, func(i, j int) bool { return status.Ports[i].Port < status.Ports[j].Port })
+	}
+
+	if image != "" {
+		cmdArgs := []string{dockerBin, "image", "inspect", "--format", "{{ json . }}", image}
+		if out, err := d._ExecCmd(cmdArgs, true); err == nil {
+			inspect := imageInspect{}
+			if err := json.Unmarshal([]byte(out), &inspect); err != nil {
+				return nil, fmt.Errorf("cannot parse image: %w", err)
+			}
+			status.Image = &ImageStatus{inspect.ID, inspect.RepoTags, inspect.Created, inspect.Size}
+		}
+	}
+
+	// the container logs are only known once it is created
+	container, created := "", false
+	if status.Created {
+		if id, err := d.containerID(); err == nil {
+			container, created = id, true
+		}
+	}
+	for _, step := range lifecycleSteps {
+		hook := HookStatus{Step: step, Configured: d.Config.IsSet(step)}
+		if step == "initializeCommand" || created {
+			if info, err := os.Stat(d.stepLogPath(step, container)); err == nil {
+				modTime := info.ModTime()
+				hook.LastRun = &modTime
+			}
+		}
+		status.Hooks = append(status.Hooks, hook)
+	}
+
+	if state, alive := d.ForwarderState(); alive {
+		for _, forward := range state.Forwards {
+			port := fmt.Sprint(forward.Port)
+			if forward.Host != "" {
+				port = forward.Host + ":" + port
+			}
+			status.Ports = append(status.Ports, PortStatus{port, fmt.Sprintf("127.0.0.1:%d", forward.LocalPort), "forwarded"})
+		}
+	}
+
+	return status, nil
+}
+
+// return the time with its age, e.g. "2023-05-01 10:00:00 (3 days ago)"
+func formatAge(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	age := time.Since(t)
+	var ago string
+	switch {
+	case age < time.Minute:
+		ago = "just now"
+	case age < time.Hour:
+		ago = plural(int(age.Minutes()), "minute") + " ago"
+	case age < 24*time.Hour:
+		ago = plural(int(age.Hours()), "hour") + " ago"
+	default:
+		ago = plural(int(age.Hours()/24), "day") + " ago"
+	}
+
+	return t.Local().Format("2006-01-02 15:04:05") + " (" + ago + ")"
+}
+
+func plural(n int, unit string) string {
+	return fmt.Sprintf("%d %s", n, lo.Ternary(n == 1, unit, unit+"s"))
+}
+
+// print the status in a human readable form
+func (s *Status) print() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Engine:\t%s\n", s.Engine)
+	if s.Instance != "" {
+		fmt.Fprintf(w, "Instance:\t%s\n", s.Instance)
+	}
+	fmt.Fprintf(w, "Built:\t%t\n", s.Built)
+	fmt.Fprintf(w, "Created:\t%t\n", s.Created)
+	fmt.Fprintf(w, "Running:\t%t\n", s.Running)
+	fmt.Fprintf(w, "Outdated:\t%t\n", s.Outdated)
+	if s.Image != nil {
+		fmt.Fprintf(w, "Image:\t%s %s\n", s.Image.ID, strings.Join(s.Image.Tags, " "))
+		fmt.Fprintf(w, "Image created:\t%s\n", formatAge(s.Image.Created))
+		fmt.Fprintf(w, "Image size:\t%s\n", formatSize(s.Image.Size))
+	}
+	if s.Container != nil {
+		fmt.Fprintf(w, "Container:\t%s %s\n", s.Container.ID, s.Container.Name)
+		fmt.Fprintf(w, "Container state:\t%s\n", s.Container.State)
+		fmt.Fprintf(w, "Container created:\t%s\n", formatAge(s.Container.Created))
+		fmt.Fprintf(w, "Container started:\t%s\n", formatAge(s.Container.Started))
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOOK\tCONFIGURED\tLAST RUN")
+	for _, hook := range s.Hooks {
+		lastRun := "-"
+		if hook.LastRun != nil {
+			lastRun = formatAge(*hook.LastRun)
+		}
+		fmt.Fprintf(w, "%s\t%t\t%s\n", hook.Step, hook.Configured, lastRun)
+	}
+	w.Flush()
+
+	if len(s.Volumes) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TYPE\tSOURCE\tDESTINATION")
+		for _, mount := range s.Volumes {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", mount.Type, mount.Source, mount.Destination)
+		}
+		w.Flush()
+	}
+
+	if len(s.Ports) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "PORT\tLOCAL ADDRESS\tSOURCE")
+		for _, port := range s.Ports {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", port.Port, port.LocalPort, port.Source)
+		}
+		w.Flush()
+	}
+}
+
+// COMMANDS
+
+func (d *DevContainer) Status(_ *cobra.Command, _ []string) {
+	status, err := d.GetStatus()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot get status")
+	}
+	switch statusOutput {
+	case "json":
+		out, _ := json.MarshalIndent(status, "", "  ")
+		fmt.Println(string(out))
+	case "text":
+		status.print()
+	default:
+		log.Fatal().Str("output", statusOutput).Msg("output must be text or json")
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// built-in templates, following the Dev Container Templates layout, cf.
+// https://containers.dev/implementors/templates/
+//
+//go:embed all:templates
+var builtinTemplates embed.FS
+
+// template used when none is given nor detected
+const defaultTemplate = "alpine"
+
+// template files which are not copied into the workspace
+var templateMetadataFiles = []string{"devcontainer-template.json", "NOTES.md", "README.md"}
+
+// templates suggested by the files found in the workspace, by priority
+var templateDetections = []struct {
+	File     string
+	Template string
+}{
+	{"go.mod", "go"},
+	{"Cargo.toml", "rust"},
+	{"package.json", "node"},
+	{"pyproject.toml", "python"},
+	{"requirements.txt", "python"},
+	{"setup.py", "python"},
+	{"Pipfile", "python"},
+}
+
+// TemplateOption is an option declared by devcontainer-template.json
+type TemplateOption struct {
+	Type        string      `json:"type"`
+	Description string      `json:"description"`
+	Proposals   []string    `json:"proposals"`
+	Enum        []string    `json:"enum"`
+	Default     interface{} `json:"default"`
+}
+
+// Template is a devcontainer configuration template
+type Template struct {
+	ID          string                    `json:"id"`
+	Name        string                    `json:"name"`
+	Description string                    `json:"description"`
+	Options     map[string]TemplateOption `json:"options"`
+	files       fs.FS
+}
+
+// DetectTemplate return the template suggested by the workspace files and the
+// file that suggested it
+func DetectTemplate(dir string) (string, string) {
+	for _, detection := range templateDetections {
+		if _, err := os.Stat(filepath.Join(dir, detection.File)); err == nil {
+			return detection.Template, detection.File
+		}
+	}
+
+	return "", ""
+}
+
+// BuiltinTemplates return the built-in templates sorted by id
+func BuiltinTemplates() []*Template {
+	entries, _ := builtinTemplates.ReadDir("templates")
+	templates := []*Template{}
+	for _, entry := range entries {
+		files, _ := fs.Sub(builtinTemplates, "templates/"+entry.Name())
+		if t, err := readTemplate(files); err == nil {
+			templates = append(templates, t)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].ID < templates[j].ID })
+
+	return templates
+}
+
+// LoadTemplate return the template from a built-in id, a local directory or an
+// OCI reference
+func LoadTemplate(ref string, cacheDir string) (*Template, error) {
+	if files, err := fs.Sub(builtinTemplates, "templates/"+ref); err == nil && !strings.Contains(ref, "/") {
+		if _, err := fs.Stat(files, "devcontainer-template.json"); err == nil {
+			return readTemplate(files)
+		}
+	}
+
+	if info, err := os.Stat(ref); err == nil && info.IsDir() {
+		return readTemplate(os.DirFS(ref))
+	}
+
+	ociRef, err := ParseOCIRef(ref)
+	if err != nil {
+		return nil, fmt.Errorf("unknown template %q", ref)
+	}
+	dir := filepath.Join(cacheDir, "templates", md5sum(ociRef.String()))
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	log.Info().Str("template", ociRef.String()).Msg("pulling template")
+	if err := NewOCIRegistry().Pull(ociRef, dir); err != nil {
+		return nil, err
+	}
+
+	return readTemplate(os.DirFS(dir))
+}
+
+func readTemplate(files fs.FS) (*Template, error) {
+	content, err := fs.ReadFile(files, "devcontainer-template.json")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read template metadata: %w", err)
+	}
+	t := &Template{files: files}
+	if err := json.Unmarshal(content, t); err != nil {
+		return nil, fmt.Errorf("cannot parse template metadata: %w", err)
+	}
+
+	return t, nil
+}
+
+// ResolveOptions check the given options and complete them with the defaults
+func (t *Template) ResolveOptions(values map[string]string) (map[string]string, error) {
+	options := map[string]string{}
+	for name, value := range values {
+		option, ok := t.Options[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown option %q for template %s", name, t.ID)
+		}
+		if option.Type == "boolean" && value != "true" && value != "false" {
+			return nil, fmt.Errorf("option %q must be true or false", name)
+		}
+		if len(option.Enum) > 0 && !lo.Contains(option.Enum, value) {
+			return nil, fmt.Errorf("option %q must be one of %s", name, strings.Join(option.Enum, ", "))
+		}
+		options[name] = value
+	}
+	for name, option := range t.Options {
+		if _, ok := options[name]; !ok && option.Default != nil {
+			options[name] = fmt.Sprint(option.Default)
+		}
+	}
+
+	return options, nil
+}
+
+// Apply copy the template files into the workspace, the .devcontainer
+// directory going to the configuration directory, and substitute the options
+func (t *Template) Apply(workspace string, configDir string, options map[string]string) ([]string, error) {
+	files := map[string]string{}
+	err := fs.WalkDir(t.files, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || lo.Contains(templateMetadataFiles, path) {
+			return err
+		}
+		switch {
+		case path == ".devcontainer.json":
+			files[path] = filepath.Join(configDir, "devcontainer.json")
+		case strings.HasPrefix(path, ".devcontainer/"):
+			files[path] = filepath.Join(configDir, strings.TrimPrefix(path, ".devcontainer/"))
+		default:
+			files[path] = filepath.Join(workspace, filepath.FromSlash(path))
+		}
+		if _, err := os.Stat(files[path]); err == nil {
+			return fmt.Errorf("%s already exists", files[path])
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	option := regexp.MustCompile(`\$\{templateOption:\s*(\w+)\s*\}`)
+	created := []string{}
+	for src, dst := range files {
+		content, err := fs.ReadFile(t.files, src)
+		if err != nil {
+			return created, err
+		}
+		content = option.ReplaceAllFunc(content, func(match []byte) []byte {
+			return []byte(options[string(option.FindSubmatch(match)[1])])
+		})
+		if err := writeFile(dst, content); err != nil {
+			return created, err
+		}
+		created = append(created, dst)
+	}
+	sort.Strings(created)
+
+	return created, nil
+}
+
+// parse key=value command line options
+func splitOptions(args []string) map[string]string {
+	options := map[string]string{}
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found {
+			log.Fatal().Str("option", arg).Msg("options must be formatted as key=value")
+		}
+		options[key] = value
+	}
+
+	return options
+}
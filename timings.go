@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Timing is the duration of a devcontainer phase
+type Timing struct {
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Timings records the duration of the devcontainer phases
+type Timings struct {
+	mu     sync.Mutex
+	start  time.Time
+	phases []Timing
+}
+
+// trace event, cf. the Trace Event Format specification
+type traceEvent struct {
+	Name      string `json:"name"`
+	Category  string `json:"cat"`
+	Phase     string `json:"ph"`
+	Timestamp int64  `json:"ts"`
+	Duration  int64  `json:"dur"`
+	Pid       int    `json:"pid"`
+	Tid       int    `json:"tid"`
+}
+
+// Reset start recording from now
+func (t *Timings) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.start = time.Now()
+	t.phases = nil
+}
+
+// Time run the function and record its duration under the given name
+func (t *Timings) Time(name string, f func()) {
+	start := time.Now()
+	f()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, Timing{Name: name, Start: start, Duration: time.Since(start)})
+}
+
+// Summary print the phases durations as a table
+func (t *Timings) Summary() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PHASE\tSTART\tDURATION")
+	for _, phase := range t.phases {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", phase.Name, roundDuration(phase.Start.Sub(t.start)), roundDuration(phase.Duration))
+	}
+	fmt.Fprintf(w, "total\t\t%s\n", roundDuration(time.Since(t.start)))
+	w.Flush()
+}
+
+// WriteTrace write the phases as a Chrome trace-event JSON file
+func (t *Timings) WriteTrace(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := []traceEvent{{
+		Name:     "devc",
+		Category: "devc",
+		Phase:    "X",
+		Duration: time.Since(t.start).Microseconds(),
+		Pid:      os.Getpid(),
+		Tid:      1,
+	}}
+	for _, phase := range t.phases {
+		events = append(events, traceEvent{
+			Name:      phase.Name,
+			Category:  "devc",
+			Phase:     "X",
+			Timestamp: phase.Start.Sub(t.start).Microseconds(),
+			Duration:  phase.Duration.Microseconds(),
+			Pid:       os.Getpid(),
+			Tid:       1,
+		})
+	}
+
+	return writeJSON(path, map[string]interface{}{"traceEvents": events, "displayTimeUnit": "ms"})
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
+
+// ReportTimings print the timings summary and write the trace file, if asked
+func (d *DevContainer) ReportTimings() {
+	if timingsSummary {
+		d.Timings.Summary()
+	}
+	if timingsTraceFile != "" {
+		if err := d.Timings.WriteTrace(timingsTraceFile); err != nil {
+			log.Error().Err(err).Msg("cannot write trace file")
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// user settings merged into the devc customizations of the project
+var userCustomizations = []string{"autoForwardPorts", "copyGitConfig", "forwardGpgAgent", "forwardSshAgent"}
+
+// UserConfigPath return the path of the user configuration file
+func UserConfigPath() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, _ := os.UserHomeDir()
+		configDir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(configDir, "devc", "config.json")
+}
+
+// ParseUserConfig load the user configuration and apply its defaults to the
+// flags that were not given
+func (d *DevContainer) ParseUserConfig(cmd *cobra.Command) {
+	d.UserConfig = viper.New()
+	d.UserConfig.SetConfigType("json")
+	jc, err := os.ReadFile(UserConfigPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		log.Fatal().Err(err).Msg("cannot read user settings")
+	}
+	root, err := ParseJSONC(jc)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot parse user settings")
+	}
+	j, err := json.Marshal(root.Interface())
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot read user settings")
+	}
+	if err := d.UserConfig.ReadConfig(bytes.NewBuffer(j)); err != nil {
+		log.Fatal().Err(err).Msg("cannot read json")
+	}
+	log.Debug().Str("user", fmt.Sprintf("%+v", d.UserConfig)).Send()
+
+	if engine := d.UserConfig.GetString("engine"); engine != "" {
+		dockerBin = engine
+	}
+	flags := map[string]*string{
+		"shell":                    &shellBin,
+		"dotfiles-repository":      &startDotfilesRepository,
+		"dotfiles-install-command": &startDotfilesInstallCommand,
+		"dotfiles-target-path":     &startDotfilesTargetPath,
+	}
+	keys := map[string]string{
+		"shell":                    "shell",
+		"dotfiles-repository":      "dotfiles.repository",
+		"dotfiles-install-command": "dotfiles.installCommand",
+		"dotfiles-target-path":     "dotfiles.targetPath",
+	}
+	for flag, value := range flags {
+		if !cmd.Flags().Changed(flag) && d.UserConfig.IsSet(keys[flag]) {
+			*value = d.UserConfig.GetString(keys[flag])
+		}
+	}
+}
+
+// MergeUserConfig merge the user settings into the project configuration:
+// project settings take precedence, lists are appended and maps are merged
+func (d *DevContainer) MergeUserConfig() {
+	for _, key := range userCustomizations {
+		if !d.Config.IsSet("customizations.devc."+key) && d.UserConfig.IsSet(key) {
+			d.Config.Set("customizations.devc."+key, d.UserConfig.Get(key))
+		}
+	}
+
+	if d.UserConfig.IsSet("mounts") {
+		mounts, _ := d.Config.Get("mounts").([]interface{})
+		userMounts, _ := d.UserConfig.Get("mounts").([]interface{})
+		d.Config.Set("mounts", append(mounts, userMounts...))
+	}
+
+	for _, key := range []string{"containerEnv", "remoteEnv"} {
+		if !d.UserConfig.IsSet(key) {
+			continue
+		}
+		env := d.UserConfig.GetStringMapString(key)
+		for k, v := range d.Config.GetStringMapString(key) {
+			env[k] = v
+		}
+		d.Config.Set(key, env)
+	}
+}
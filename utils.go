@@ -1,40 +1,322 @@
 package main
 
 import (
+	"archive/tar"
 	"bytes"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
 	"github.com/spf13/viper"
-	"muzzammil.xyz/jsonc"
 )
 
-// runs the given command while attaching stdin, stdout and stderr
-func execCmd(command []string, capture bool) (string, error) {
-	var stdout []byte
-	var err error
+// runs the given command while attaching stdin, stdout and stderr, its output
+// being also written to the given writers, if any, and captured commands then
+// only writing their errors to them
+func execCmd(command []string, capture bool, output ...io.Writer) (string, error) {
+	var stdout bytes.Buffer
 
 	cwd, _ := os.Getwd()
 	cmd := exec.Command(command[0], command[1:]...)
-	log.Info().Str("workdir", cwd).Str("command", cmd.String()).Send()
+	engine := commandEngine(command)
+	log.Info().Str("engine", engine).Str("workdir", cwd).Str("command", cmd.String()).Send()
+	start := time.Now()
 	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = teeWriter(os.Stdout, output)
+	cmd.Stderr = teeWriter(os.Stderr, output)
 	if capture {
-		stdout, err = cmd.Output()
-	} else {
-		cmd.Stdout = os.Stdout
-		err = cmd.Run()
+		cmd.Stdout = teeWriter(&stdout, output)
+		// not attached to the terminal, e.g. running in the background
+		if len(output) > 0 {
+			cmd.Stdin = nil
+			cmd.Stderr = io.MultiWriter(output...)
+		}
+	}
+	err := cmd.Run()
+	log.Info().
+		Str("engine", engine).
+		Str("command", cmd.String()).
+		Dur("duration", time.Since(start)).
+		Int("exit_code", exitCode(err)).
+		Msg("command finished")
+
+	return strings.TrimSpace(stdout.String()), err
+}
+
+// return the writer duplicated to the outputs, the writer itself without
+// outputs so that a terminal stays one
+func teeWriter(w io.Writer, output []io.Writer) io.Writer {
+	if len(output) == 0 {
+		return w
+	}
+
+	return io.MultiWriter(append([]io.Writer{w}, output...)...)
+}
+
+// return whether the standard input is a terminal
+func isTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// return the engine running the command, or host for other commands
+func commandEngine(command []string) string {
+	switch {
+	case len(command) > 1 && command[0] == dockerBin && command[1] == "compose":
+		return dockerBin + " compose"
+	case len(command) > 0 && command[0] == dockerBin:
+		return dockerBin
+	default:
+		return "host"
+	}
+}
+
+// return the exit code of the command error, -1 if it did not run
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode()
+	default:
+		return -1
+	}
+}
+
+// engine sub-commands which do not change anything
+var queryCommands = []string{
+	"config", "container inspect", "container ls", "image inspect", "image ls",
+	"images", "info", "inspect", "ls", "ps", "volume inspect", "volume ls",
+}
+
+// return true if the command is an engine query
+func isQueryCommand(command []string) bool {
+	if len(command) < 2 || command[0] != dockerBin {
+		return false
+	}
+	args := command[1:]
+	if args[0] == "compose" {
+		args = args[1:]
+		for len(args) > 1 && (args[0] == "--project-name" || args[0] == "--file") {
+			args = args[2:]
+		}
+	}
+	line := strings.Join(args, " ") + " "
+
+	return lo.SomeBy(queryCommands, func(q string) bool { return strings.HasPrefix(line, q+" ") })
+}
+
+// name of the container in the commands printed in dry-run mode, before it is
+// created
+const dryRunContainer = "<container>"
+
+// prints the given command instead of running it, engine queries being still
+// run so that the printed commands match the current state
+func dryRunCmd(command []string, capture bool, _ ...io.Writer) (string, error) {
+	if isQueryCommand(command) {
+		out, err := execCmd(command, true)
+		if err != nil {
+			log.Debug().Err(err).Str("command", shellJoin(command)).Msg("query failed, assuming nothing exists")
+			return "", nil
+		}
+		return out, nil
 	}
+	fmt.Println(shellJoin(command))
 
-	return strings.TrimSpace(string(stdout)), err
+	return "", nil
+}
+
+// quote the string for a POSIX shell, if needed
+func shellQuote(s string) string {
+	if s != "" && regexp.MustCompile(`^[[:alnum:]%+,./:=@_-]+$`).MatchString(s) {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// return the command as a shell-quoted string
+func shellJoin(command []string) string {
+	return strings.Join(lo.Map(command, func(v string, _ int) string { return shellQuote(v) }), " ")
+}
+
+// run the change of the host, or print its shell equivalent, if any, instead
+// in dry-run mode
+func hostChange(equivalent string, change func() error) error {
+	if rootDryRun {
+		if equivalent != "" {
+			fmt.Println(equivalent)
+		}
+		return nil
+	}
+
+	return change()
+}
+
+// write the data into the file, creating its directory
+func writeFile(path string, data []byte) error {
+	equivalent := "cat > " + shellQuote(path) + " <<'EOF'\n" + strings.TrimSuffix(string(data), "\n") + "\nEOF"
+	return hostChange(equivalent, func() error {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		return os.WriteFile(path, data, 0644)
+	})
+}
+
+// write the given value as indented JSON into the file
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, append(data, '\n'))
+}
+
+// write the content of the directory as a tar archive
+func tarDir(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// return the chown owner of the user, with its login group unless it is given
+// as user:group
+func chownOwner(user string) string {
+	if strings.Contains(user, ":") {
+		return user
+	}
+
+	return user + ":"
+}
+
+// copy the content of the host directory into the container directory, as the
+// remote user
+func copyToContainer(e Engine, src string, dst string) error {
+	cmdArgs := e.ExecArgs([]string{"sh", "-c", `mkdir -p "$0" && tar -xf - -C "$0"`, dst}, false)
+	equivalent := shellJoin([]string{"tar", "-cf", "-", "-C", src, "."}) + " | " + shellJoin(cmdArgs)
+
+	return hostChange(equivalent, func() error { return pipeTarDir(cmdArgs, src) })
+}
+
+// run the command with the content of the directory as a tar archive on its
+// standard input
+func pipeTarDir(cmdArgs []string, src string) error {
+	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	log.Info().Str("command", cmd.String()).Send()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := tarDir(src, stdin); err != nil {
+		stdin.Close()
+		cmd.Wait()
+		return err
+	}
+	stdin.Close()
+
+	return cmd.Wait()
+}
+
+// return the identifier of the devcontainer, stable across rebuilds, computed
+// like the reference implementation from its identifying labels
+func devcontainerID(localFolder string, configFile string, instance string) string {
+	labels := map[string]string{
+		"devcontainer.config_file":  configFile,
+		"devcontainer.local_folder": localFolder,
+	}
+	if instance != "" {
+		labels[instanceLabel] = instance
+	}
+	content, _ := json.Marshal(labels)
+	sum := sha256.Sum256(content)
+	id := new(big.Int).SetBytes(sum[:]).Text(32)
+
+	return strings.Repeat("0", 52-len(id)) + id
+}
+
+// return the values of the "<value> <instance label>" lines of the instance,
+// the engines not being able to filter out the labelled ones
+func filterInstance(out string, instance string) []string {
+	values := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		value, label, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if value != "" && label == instance {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// return the name with the characters not allowed in container names replaced
+func containerName(name string) string {
+	name = regexp.MustCompile(`[^a-zA-Z0-9_.-]`).ReplaceAllString(name, "-")
+
+	return strings.TrimLeft(name, "_.-")
 }
 
 // return the md5 hash for a string
@@ -86,7 +368,24 @@ func resolveContainerEnv(e Engine, s string) string {
 // PRERUN UTILS
 
 func (d *DevContainer) SetLogLevel() {
-	log = zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout}).With().Timestamp().Logger()
+	// logs go to stderr so that they do not mix with the commands output
+	var out io.Writer = os.Stderr
+	log = zerolog.New(zerolog.ConsoleWriter{Out: out}).With().Timestamp().Logger()
+	if rootLogFile != "" {
+		file, err := os.OpenFile(rootLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot open log file")
+		}
+		out = file
+	}
+	switch rootLogFormat {
+	case "console":
+		log = zerolog.New(zerolog.ConsoleWriter{Out: out, NoColor: rootLogFile != ""}).With().Timestamp().Logger()
+	case "json":
+		log = zerolog.New(out).With().Timestamp().Logger()
+	default:
+		log.Fatal().Str("format", rootLogFormat).Msg("log format must be one of: console, json")
+	}
 
 	switch rootVerbose {
 	case 1:
@@ -98,9 +397,36 @@ func (d *DevContainer) SetLogLevel() {
 	}
 }
 
-func (d *DevContainer) ParseConfig() {
+// ParseConfig read the devcontainer settings, schema errors being fatal only
+// when strict, for the commands creating the devcontainer
+func (d *DevContainer) ParseConfig(strict bool) {
+	path := filepath.Join(rootConfigDir, "devcontainer.json")
+	jc, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot read devcontainer settings")
+	}
+
+	// check settings against the devcontainer.json schema
+	errs, warnings := ValidateFile(path, jc)
+	for _, w := range warnings {
+		log.Warn().Msg(w)
+	}
+	if len(errs) > 0 && strict {
+		for _, e := range errs {
+			log.Error().Msg(e)
+		}
+		log.Fatal().Msg("invalid devcontainer settings")
+	}
+	for _, e := range errs {
+		log.Warn().Msg(e)
+	}
+
 	// return JSONC as JSON
-	_, j, err := jsonc.ReadFromFile(filepath.Join(rootConfigDir, "devcontainer.json"))
+	root, err := ParseJSONC(jc)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot parse devcontainer settings")
+	}
+	j, err := json.Marshal(root.Interface())
 	if err != nil {
 		log.Fatal().Err(err).Msg("cannot read devcontainer settings")
 	}
@@ -129,6 +455,23 @@ func (d *DevContainer) NormalizeTypes() {
 	if value, ok := d.Config.Get("dockerComposeFile").(string); ok {
 		d.Config.Set("dockerComposeFile", []string{value})
 	}
+	// mounts are either --mount strings or objects, converted to strings
+	if mounts, ok := d.Config.Get("mounts").([]interface{}); ok {
+		normalized := []interface{}{}
+		for _, mount := range mounts {
+			value, err := normalizeMount(mount)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid mount")
+			}
+			normalized = append(normalized, value)
+		}
+		d.Config.Set("mounts", normalized)
+	}
+	for _, opt := range d.Config.GetStringSlice("securityOpt") {
+		if err := checkSecurityOpt(opt); err != nil {
+			log.Fatal().Err(err).Msg("invalid securityOpt")
+		}
+	}
 }
 
 func (d *DevContainer) SetDefaults() {
@@ -136,6 +479,9 @@ func (d *DevContainer) SetDefaults() {
 	d.ConfigDir = rootConfigDir
 	d.WorkingDirectoryPath, _ = os.Getwd()
 	d.WorkingDirectoryName = filepath.Base(d.WorkingDirectoryPath)
+	d.Instance = rootInstance
+	configFile, _ := filepath.Abs(filepath.Join(d.ConfigDir, "devcontainer.json"))
+	d.ID = devcontainerID(d.WorkingDirectoryPath, configFile, d.Instance)
 	d.Config.SetDefault("build.context", ".")
 	d.Config.SetDefault("name", d.WorkingDirectoryName)
 	d.Config.SetDefault("overrideCommand", true)
@@ -157,15 +503,34 @@ func (d *DevContainer) CheckConfig() {
 	if d.Config.IsSet("dockerComposeFile") && !d.Config.IsSet("service") {
 		log.Fatal().Msg("'service' setting is required when using 'dockerComposeFile'")
 	}
+	// the instance is used in container and compose project names
+	if d.Instance != "" && !regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`).MatchString(d.Instance) {
+		log.Fatal().Str("instance", d.Instance).Msg("instance must only contain lowercase letters, digits, '_' and '-'")
+	}
+}
+
+// StateDir return the directory where devc stores its files for the workspace
+func (d *DevContainer) StateDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+
+	dir := md5sum(d.WorkingDirectoryPath)
+	if d.Instance != "" {
+		dir += "-" + d.Instance
+	}
+
+	return filepath.Join(cacheDir, "devc", dir)
 }
 
 func (d *DevContainer) SetEngine() {
 	// determine container engine
 	switch {
 	case d.Config.IsSet("image") || d.Config.IsSet("build.dockerfile"):
-		d.Engine = &Docker{}
+		d.Engine = &Docker{_ExecCmd: d._ExecCmd}
 	case d.Config.IsSet("dockerComposeFile"):
-		d.Engine = &DockerCompose{}
+		d.Engine = &DockerCompose{_ExecCmd: d._ExecCmd}
 	default:
 		log.Fatal().Msg("cannot determine devcontainer engine")
 	}
@@ -184,6 +549,7 @@ func (d *DevContainer) ResolveVars() {
 	// - ${containerWorkspaceFolder}
 	// - ${localWorkspaceFolderBasename}
 	// - ${containerWorkspaceFolderBasename}
+	// - ${devcontainerId}
 	// cf. https://containers.dev/implementors/json_reference/#variables-in-devcontainerjson
 	keys := []string{
 		"build.args", "build.cacheFrom", "build.context", "build.dockerfile",
@@ -200,6 +566,7 @@ func (d *DevContainer) ResolveVars() {
 			d.Config.Set(key, strings.ReplaceAll(d.Config.GetString(key), "${containerWorkspaceFolder}", d.WorkingDirectoryPath))
 			d.Config.Set(key, strings.ReplaceAll(d.Config.GetString(key), "${localWorkspaceFolderBasename}", d.WorkingDirectoryName))
 			d.Config.Set(key, strings.ReplaceAll(d.Config.GetString(key), "${containerWorkspaceFolderBasename}", d.WorkingDirectoryName))
+			d.Config.Set(key, strings.ReplaceAll(d.Config.GetString(key), "${devcontainerId}", d.ID))
 		case []interface{}:
 			// resolve slices of strings
 			d.Config.Set(key, lo.Map(d.Config.GetStringSlice(key), func(v string, _ int) string { return resolveLocalEnv(v) }))
@@ -215,6 +582,9 @@ func (d *DevContainer) ResolveVars() {
 			d.Config.Set(key, lo.Map(d.Config.GetStringSlice(key), func(v string, _ int) string {
 				return strings.ReplaceAll(v, "${containerWorkspaceFolderBasename}", d.WorkingDirectoryName)
 			}))
+			d.Config.Set(key, lo.Map(d.Config.GetStringSlice(key), func(v string, _ int) string {
+				return strings.ReplaceAll(v, "${devcontainerId}", d.ID)
+			}))
 		case map[string]interface{}:
 			// resolve maps of strings
 			d.Config.Set(key, lo.MapValues(d.Config.GetStringMapString(key), func(v string, _ string) string { return resolveLocalEnv(v) }))
@@ -230,6 +600,9 @@ func (d *DevContainer) ResolveVars() {
 			d.Config.Set(key, lo.MapValues(d.Config.GetStringMapString(key), func(v string, _ string) string {
 				return strings.ReplaceAll(v, "${containerWorkspaceFolderBasename}", d.WorkingDirectoryName)
 			}))
+			d.Config.Set(key, lo.MapValues(d.Config.GetStringMapString(key), func(v string, _ string) string {
+				return strings.ReplaceAll(v, "${devcontainerId}", d.ID)
+			}))
 		}
 	}
 }
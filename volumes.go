@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+// COMMANDS
+
+func (d *DevContainer) VolumesList(_ *cobra.Command, _ []string) {
+	volumes, err := d.Engine.Volumes()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot list volumes")
+	}
+	for _, volume := range volumes {
+		fmt.Println(volume)
+	}
+}
+
+func (d *DevContainer) VolumesRemove(_ *cobra.Command, args []string) {
+	volumes, err := d.Engine.Volumes()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot list volumes")
+	}
+	// only remove the volumes of the devcontainer
+	if others := lo.Without(args, volumes...); len(others) > 0 {
+		log.Fatal().Strs("volumes", others).Msg("volumes do not belong to this devcontainer")
+	}
+	if _, err := d._ExecCmd(append([]string{dockerBin, "volume", "rm"}, args...), false); err != nil {
+		log.Fatal().Err(err).Msg("cannot remove volumes")
+	}
+}
+
+func (d *DevContainer) VolumesPrune(_ *cobra.Command, _ []string) {
+	// volumes which are not used by any container
+	volumes, err := d.Engine.Volumes("--filter", "dangling=true")
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot list volumes")
+	}
+	if len(volumes) == 0 {
+		log.Info().Msg("no unused volumes")
+		return
+	}
+	if _, err := d._ExecCmd(append([]string{dockerBin, "volume", "rm"}, volumes...), false); err != nil {
+		log.Fatal().Err(err).Msg("cannot remove volumes")
+	}
+}